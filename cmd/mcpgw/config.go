@@ -22,6 +22,41 @@ type Config struct {
 		TLSCert string
 		TLSKey  string
 	}
+	OAuth struct {
+		// CallbackURL is where authorization servers send the browser back to, defaults to the UI address
+		CallbackURL string
+		TokenDir    string
+	}
+	Proxy struct {
+		// Listen is where `mcpGW proxy` serves the MCP server when it is not run with --stdio
+		Listen string
+		// Token is the bearer token MCP clients must send, the proxy is open when it is empty
+		Token string
+	}
+	Conversations struct {
+		// Store is where conversations are kept, "memory" (the default) or "file"
+		Store string
+		// Dir is the directory of the file store, defaults to the user's config directory
+		Dir string
+		// IdleTimeout evicts conversations not used for this long from memory, e.g. "24h"
+		IdleTimeout string
+		// MaxConversations caps the conversations kept in memory, MaxBytes the size of each one
+		MaxConversations int
+		MaxBytes         int
+		// Concurrency is what happens to a request for a conversation busy with another one: queue, reject or cancel
+		Concurrency string
+		// Summary has messages that fall out of the window summarized by the llm instead of dropped
+		Summary struct {
+			Enabled bool
+			// Model summarizes with another model of the inference provider, e.g. a smaller one
+			Model string
+			// Prompt replaces the default summary instructions
+			Prompt string
+			// Trigger is how many messages beyond the window are summarized at once
+			Trigger   int
+			MaxTokens int
+		}
+	}
 	SpeechToText *InferenceProvider
 	TextToSpeech *InferenceProvider
 	Inference    *InferenceProvider
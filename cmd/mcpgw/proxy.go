@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+	"github.com/thirdmartini/mcpgw/pkg/mcphost"
+	"github.com/thirdmartini/mcpgw/pkg/mcpproxy"
+)
+
+var (
+	proxyStdio  bool
+	proxyListen string
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Serve the configured MCP servers as a single MCP server",
+	Long: `proxy serves the tools, resources and prompts of every configured MCP server as one
+MCP server, so MCP clients connect once to mcpGW instead of starting every server themselves.
+
+Example:
+  mcpGW proxy --config ./config.json --stdio
+  mcpGW proxy --config ./config.json --listen localhost:8090`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runProxy(context.Background())
+	},
+}
+
+func runProxy(ctx context.Context) error {
+	config, err := loadConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	// the llm is only needed to answer the sampling requests of servers
+	var provider llm.Provider
+	if config.Inference != nil {
+		if provider, err = createInferenceProvider(ctx, config.Inference); err != nil {
+			return err
+		}
+	}
+
+	listen := proxyListen
+	if listen == "" {
+		listen = config.Proxy.Listen
+	}
+	if !proxyStdio && listen == "" {
+		return fmt.Errorf("no address to listen on, use --stdio or set Proxy.Listen")
+	}
+
+	// the proxy serves the OAuth callback itself, on stdio there is nothing to come back to
+	callbackURL := config.OAuth.CallbackURL
+	if callbackURL == "" && !proxyStdio {
+		callbackURL = mcpproxy.OAuthCallbackURL(listen)
+	}
+
+	// nobody answers the host's own queues, questions of servers go to the MCP client of the call or are declined
+	host := mcphost.NewHost(provider).WithOAuth(callbackURL, config.OAuth.TokenDir).WithUnattended()
+	if err := host.WithConfig(config.Servers); err != nil {
+		return err
+	}
+	defer host.Close()
+
+	go watchConfig(ctx, host)
+
+	proxy := mcpproxy.NewProxy(host, "mcpGW", "0.1.0")
+	if provider != nil {
+		proxy.WithAssistant(config.Inference.SystemPrompt)
+	}
+	if proxyStdio {
+		log.Info("Serving MCP proxy on stdio")
+		return proxy.ServeStdio()
+	}
+
+	log.Infof("Serving MCP proxy at [ %s%s ]", listen, mcpproxy.StreamableHTTPPath)
+	return http.ListenAndServe(listen, proxy.Handler(config.Proxy.Token))
+}
+
+func init() {
+	proxyCmd.Flags().BoolVar(&proxyStdio, "stdio", false, "serve on stdin and stdout")
+	proxyCmd.Flags().StringVar(&proxyListen, "listen", "", "address to serve Streamable HTTP and SSE on (default is Proxy.Listen)")
+	rootCmd.AddCommand(proxyCmd)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/thirdmartini/mcpgw/pkg/mcphost"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 5 * time.Second
+
+// reloadServers re-reads the config file and applies its MCP server section to the host
+func reloadServers(host *mcphost.Host) error {
+	config, err := loadConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Reloading MCP server configuration", "config", configFile)
+	return host.Reload(config.Servers)
+}
+
+// watchConfig reloads the MCP servers when the config file changes or the process receives SIGHUP
+func watchConfig(ctx context.Context, host *mcphost.Host) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var modified time.Time
+	if info, err := os.Stat(configFile); err == nil {
+		modified = info.ModTime()
+	}
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hangup:
+			log.Info("Received SIGHUP")
+
+		case <-ticker.C:
+			info, err := os.Stat(configFile)
+			if err != nil || !info.ModTime().After(modified) {
+				continue
+			}
+			modified = info.ModTime()
+			log.Info("Config file changed", "config", configFile)
+		}
+
+		if err := reloadServers(host); err != nil {
+			log.Error("Failed to reload config", "error", err)
+		}
+	}
+}
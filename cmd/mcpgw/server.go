@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/charmbracelet/log"
 
@@ -72,6 +73,22 @@ func createTextToSpeechProvider(config *InferenceProvider) (speaker.Engine, erro
 	}
 }
 
+func createConversationStore(store string, dir string) (mcphost.ConversationStore, error) {
+	switch store {
+	case "", "memory":
+		return mcphost.NewMemoryStore(), nil
+
+	case "file":
+		if dir == "" {
+			dir = mcphost.DefaultConversationDir()
+		}
+		return mcphost.NewFileStore(dir)
+
+	default:
+		return nil, fmt.Errorf("unsupported conversation store: %s", store)
+	}
+}
+
 func loadConfig(configFile string) (*Config, error) {
 	data, err := os.ReadFile(configFile)
 	if err != nil {
@@ -97,9 +114,62 @@ func runServer(ctx context.Context) error {
 		return err
 	}
 
-	host := mcphost.NewHost(provider)
-	host.WithConfig(config.Servers)
-	srv := server.NewServer(host, config.Inference.SystemPrompt)
+	callbackURL := config.OAuth.CallbackURL
+	if callbackURL == "" {
+		callbackURL = server.OAuthCallbackURL(config.UI.Listen, config.UI.TLS)
+	}
+
+	host := mcphost.NewHost(provider).WithOAuth(callbackURL, config.OAuth.TokenDir)
+	if err := host.WithConfig(config.Servers); err != nil {
+		return err
+	}
+	defer host.Close()
+	go watchConfig(ctx, host)
+
+	store, err := createConversationStore(config.Conversations.Store, config.Conversations.Dir)
+	if err != nil {
+		return err
+	}
+
+	limits := mcphost.ConversationLimits{
+		MaxConversations: config.Conversations.MaxConversations,
+		MaxBytes:         config.Conversations.MaxBytes,
+	}
+	if config.Conversations.IdleTimeout != "" {
+		if limits.IdleTimeout, err = time.ParseDuration(config.Conversations.IdleTimeout); err != nil {
+			return fmt.Errorf("invalid conversation idle timeout: %w", err)
+		}
+	}
+
+	policy, err := mcphost.ParseConcurrencyPolicy(config.Conversations.Concurrency)
+	if err != nil {
+		return err
+	}
+
+	srv := server.NewServer(host, config.Inference.SystemPrompt).
+		WithConversationStore(store).
+		WithConversationLimits(ctx, limits).
+		WithConcurrencyPolicy(policy)
+	if summary := config.Conversations.Summary; summary.Enabled {
+		summaryConfig := *config.Inference
+		if summary.Model != "" {
+			summaryConfig.Model = summary.Model
+		}
+		summaryProvider, err := createInferenceProvider(ctx, &summaryConfig)
+		if err != nil {
+			return fmt.Errorf("summary provider: %w", err)
+		}
+		log.Infof("Summarizing conversations with: %s", llm.ModelName(summaryProvider))
+		srv.WithSummarizer(mcphost.NewSummarizer(summaryProvider, mcphost.SummaryOptions{
+			Prompt:    summary.Prompt,
+			Trigger:   summary.Trigger,
+			MaxTokens: summary.MaxTokens,
+		}))
+	}
+
+	srv.WithReloader(func() error {
+		return reloadServers(host)
+	})
 
 	log.Infof("Using Inference provider: %sn", provider.Name())
 	if transcriber, err := createSpeechToTextProvider(config.SpeechToText); err == nil {
@@ -0,0 +1,262 @@
+// oauthdemo is a Streamable HTTP MCP server protected by a built in stand-in OAuth authorization server.
+// It implements just enough of the MCP authorization spec (protected resource and authorization server
+// metadata, dynamic client registration, PKCE authorization code, refresh token and client credentials
+// grants) to try out the gateway's OAuth support locally. The authorization step is approved automatically.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type authorizationCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+}
+
+type authServer struct {
+	issuer string
+	ttl    time.Duration
+
+	// clientID and clientSecret are accepted for the client credentials grant
+	clientID     string
+	clientSecret string
+
+	lock          sync.Mutex
+	clients       map[string]bool
+	codes         map[string]authorizationCode
+	accessTokens  map[string]time.Time
+	refreshTokens map[string]string
+}
+
+func randomString() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func oauthError(w http.ResponseWriter, status int, code string, description string) {
+	log.Printf("token error: %s %s", code, description)
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func (a *authServer) protectedResource(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"resource":              a.issuer + "/mcp",
+		"authorization_servers": []string{a.issuer},
+	})
+}
+
+func (a *authServer) metadata(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                           a.issuer,
+		"authorization_endpoint":           a.issuer + "/authorize",
+		"token_endpoint":                   a.issuer + "/token",
+		"registration_endpoint":            a.issuer + "/register",
+		"response_types_supported":         []string{"code"},
+		"grant_types_supported":            []string{"authorization_code", "refresh_token", "client_credentials"},
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+func (a *authServer) register(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ClientName string `json:"client_name"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+
+	clientID := "client-" + randomString()
+	a.lock.Lock()
+	a.clients[clientID] = true
+	a.lock.Unlock()
+
+	log.Printf("registered client %s (%s)", clientID, request.ClientName)
+	writeJSON(w, http.StatusCreated, map[string]string{"client_id": clientID})
+}
+
+// authorize approves every request right away and sends the browser back with a code
+func (a *authServer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	a.lock.Lock()
+	known := a.clients[query.Get("client_id")]
+	a.lock.Unlock()
+	if !known {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	a.lock.Lock()
+	a.codes[code] = authorizationCode{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	a.lock.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+
+	log.Printf("approved authorization for %s", query.Get("client_id"))
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (a *authServer) issue(w http.ResponseWriter, clientID string, refresh bool) {
+	accessToken := randomString()
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(a.ttl.Seconds()),
+	}
+
+	a.lock.Lock()
+	a.accessTokens[accessToken] = time.Now().Add(a.ttl)
+	if refresh {
+		refreshToken := randomString()
+		a.refreshTokens[refreshToken] = clientID
+		response["refresh_token"] = refreshToken
+	}
+	a.lock.Unlock()
+
+	log.Printf("issued token for %s", clientID)
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *authServer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		a.lock.Lock()
+		code, ok := a.codes[r.PostForm.Get("code")]
+		delete(a.codes, r.PostForm.Get("code"))
+		a.lock.Unlock()
+
+		if !ok || code.clientID != r.PostForm.Get("client_id") || code.redirectURI != r.PostForm.Get("redirect_uri") {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "unknown code")
+			return
+		}
+
+		hash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(hash[:]) != code.codeChallenge {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "code verifier does not match")
+			return
+		}
+		a.issue(w, code.clientID, true)
+
+	case "refresh_token":
+		a.lock.Lock()
+		clientID, ok := a.refreshTokens[r.PostForm.Get("refresh_token")]
+		delete(a.refreshTokens, r.PostForm.Get("refresh_token"))
+		a.lock.Unlock()
+
+		if !ok {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "unknown refresh token")
+			return
+		}
+		a.issue(w, clientID, true)
+
+	case "client_credentials":
+		if a.clientID == "" || r.PostForm.Get("client_id") != a.clientID || r.PostForm.Get("client_secret") != a.clientSecret {
+			oauthError(w, http.StatusUnauthorized, "invalid_client", "wrong client credentials")
+			return
+		}
+		a.issue(w, a.clientID, false)
+
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", r.PostForm.Get("grant_type"))
+	}
+}
+
+// protect rejects MCP requests without a valid access token
+func (a *authServer) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		a.lock.Lock()
+		expires, ok := a.accessTokens[token]
+		a.lock.Unlock()
+
+		if !ok || time.Now().After(expires) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata="%s/.well-known/oauth-protected-resource"`, a.issuer))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func main() {
+	listen := flag.String("listen", "localhost:8932", "address to listen on")
+	ttl := flag.Duration("ttl", 5*time.Minute, "lifetime of access tokens")
+	clientID := flag.String("client-id", "", "client id accepted for the client credentials grant")
+	clientSecret := flag.String("client-secret", "", "client secret accepted for the client credentials grant")
+	flag.Parse()
+
+	auth := &authServer{
+		issuer:        "http://" + *listen,
+		ttl:           *ttl,
+		clientID:      *clientID,
+		clientSecret:  *clientSecret,
+		clients:       make(map[string]bool),
+		codes:         make(map[string]authorizationCode),
+		accessTokens:  make(map[string]time.Time),
+		refreshTokens: make(map[string]string),
+	}
+
+	s := server.NewMCPServer("OAuth Demo Server", "1.0.0")
+	s.AddTool(mcp.NewTool("whoami",
+		mcp.WithDescription("tells the caller that it is authorized"),
+	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("you are authorized"), nil
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-protected-resource", auth.protectedResource)
+	mux.HandleFunc("/.well-known/oauth-authorization-server", auth.metadata)
+	mux.HandleFunc("/register", auth.register)
+	mux.HandleFunc("/authorize", auth.authorize)
+	mux.HandleFunc("/token", auth.token)
+	mux.Handle("/mcp", auth.protect(server.NewStreamableHTTPServer(s)))
+
+	log.Printf("OAuth demo server at %s/mcp", auth.issuer)
+	log.Fatal(http.ListenAndServe(*listen, mux))
+}
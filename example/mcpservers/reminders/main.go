@@ -22,6 +22,7 @@ func main() {
 		"1.0.0",
 		server.WithResourceCapabilities(true, true),
 		server.WithLogging(),
+		server.WithElicitation(),
 	)
 	// Add tool
 	tool := mcp.NewTool("createReminder",
@@ -79,6 +80,23 @@ func main() {
 		),
 		listCompletedReminders)
 
+	s.AddResource(mcp.NewResource(activeRemindersURI, "Active reminders",
+		mcp.WithResourceDescription("the reminders the user has not completed yet"),
+		mcp.WithMIMEType("text/plain"),
+	), readActiveReminders)
+
+	s.AddResourceTemplate(mcp.NewResourceTemplate("reminders://reminder/{title}", "Reminder",
+		mcp.WithTemplateDescription("the contents of a reminder by its title"),
+		mcp.WithTemplateMIMEType("text/plain"),
+	), readReminder)
+
+	s.AddPrompt(mcp.NewPrompt("plan",
+		mcp.WithPromptDescription("plans the day around the active reminders"),
+		mcp.WithArgument("focus",
+			mcp.ArgumentDescription("what to prioritize, for example errands or work"),
+		),
+	), planReminders)
+
 	// Start the stdio server
 	if err := server.ServeStdio(s); err != nil {
 		fmt.Printf("Server error: %v\n", err)
@@ -99,6 +117,8 @@ type ReminderList struct {
 
 var reminderFile = "reminders.json"
 
+const activeRemindersURI = "reminders://active"
+
 func loadReminders() *ReminderList {
 	reminders := &ReminderList{}
 
@@ -123,13 +143,20 @@ func saveReminders(reminders *ReminderList) error {
 	return os.WriteFile(reminderFile, data, 0644)
 }
 
+// notifyUpdated tells the clients that the list of active reminders changed
+func notifyUpdated(ctx context.Context) {
+	if s := server.ServerFromContext(ctx); s != nil {
+		s.SendNotificationToAllClients(mcp.MethodNotificationResourceUpdated, map[string]any{"uri": activeRemindersURI})
+	}
+}
+
 func createReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	title, ok := request.Params.Arguments["title"].(string)
+	title, ok := request.GetArguments()["title"].(string)
 	if !ok {
 		return nil, errors.New("the title must be a string")
 	}
 
-	content, ok := request.Params.Arguments["content"].(string)
+	content, ok := request.GetArguments()["content"].(string)
 	if !ok {
 		return nil, errors.New("the content needs to be a string")
 	}
@@ -143,17 +170,67 @@ func createReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.Call
 	})
 
 	saveReminders(reminderList)
+	notifyUpdated(ctx)
 
 	return mcp.NewToolResultText(fmt.Sprintf("a reminder titled %s was created", title)), nil
 }
 
+// resolveTitle finds the reminder a title refers to. When it only partially matches several reminders
+// the user is asked which one they meant.
+func resolveTitle(ctx context.Context, reminders []Reminder, title string) string {
+	var matches []any
+	for _, reminder := range reminders {
+		if strings.ToLower(reminder.Title) == strings.ToLower(title) {
+			return title
+		}
+		if strings.Contains(strings.ToLower(reminder.Title), strings.ToLower(title)) {
+			matches = append(matches, reminder.Title)
+		}
+	}
+
+	s := server.ServerFromContext(ctx)
+	switch {
+	case len(matches) == 1:
+		return matches[0].(string)
+	case len(matches) == 0 || s == nil:
+		return title
+	}
+
+	result, err := s.RequestElicitation(ctx, mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: fmt.Sprintf("Which of these reminders did you mean by %q?", title),
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"title": map[string]any{
+						"type": "string",
+						"enum": matches,
+					},
+				},
+				"required": []string{"title"},
+			},
+		},
+	})
+	if err != nil || result.Action != mcp.ElicitationResponseActionAccept {
+		return title
+	}
+
+	if content, ok := result.Content.(map[string]any); ok {
+		if choice, ok := content["title"].(string); ok {
+			return choice
+		}
+	}
+	return title
+}
+
 func deleteReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	title, ok := request.Params.Arguments["title"].(string)
+	title, ok := request.GetArguments()["title"].(string)
 	if !ok {
 		return nil, errors.New("the title must be a string")
 	}
 
 	reminderList := loadReminders()
+	title = resolveTitle(ctx, reminderList.Reminders, title)
 
 	found := false
 	newReminderList := &ReminderList{}
@@ -172,6 +249,7 @@ func deleteReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.Call
 	if err := saveReminders(newReminderList); err != nil {
 		return mcp.NewToolResultText(fmt.Sprintf("the reminder titled %s could not be deleted", title)), nil
 	}
+	notifyUpdated(ctx)
 
 	return mcp.NewToolResultText(fmt.Sprintf("the reminder titled %s was deleted", title)), nil
 }
@@ -192,7 +270,7 @@ func listReminders(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallT
 }
 
 func showReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	title, ok := request.Params.Arguments["title"].(string)
+	title, ok := request.GetArguments()["title"].(string)
 	if !ok {
 		return nil, errors.New("the title must be a string")
 	}
@@ -209,12 +287,13 @@ func showReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallTo
 }
 
 func completeReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	title, ok := request.Params.Arguments["title"].(string)
+	title, ok := request.GetArguments()["title"].(string)
 	if !ok {
 		return nil, errors.New("the title must be a string")
 	}
 
 	reminderList := loadReminders()
+	title = resolveTitle(ctx, reminderList.Reminders, title)
 
 	found := false
 	newReminderList := &ReminderList{}
@@ -236,6 +315,7 @@ func completeReminder(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 	if err := saveReminders(newReminderList); err != nil {
 		return mcp.NewToolResultText(fmt.Sprintf("the reminder titled %s could not be completed", title)), nil
 	}
+	notifyUpdated(ctx)
 
 	return mcp.NewToolResultText(fmt.Sprintf("the reminder titled %s was completed", title)), nil
 }
@@ -254,3 +334,66 @@ func listCompletedReminders(ctx context.Context, request mcp.CallToolRequest) (*
 
 	return mcp.NewToolResultText(completedList), nil
 }
+
+func readActiveReminders(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	reminderList := loadReminders()
+
+	text := "The user has no reminders"
+	if len(reminderList.Reminders) > 0 {
+		text = "The user has the following reminders:"
+		for _, reminder := range reminderList.Reminders {
+			text += fmt.Sprintf("\n* %s (created %s): %s", reminder.Title, reminder.Date.Format("January 2, 2006"), reminder.Content)
+		}
+	}
+
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      request.Params.URI,
+			MIMEType: "text/plain",
+			Text:     text,
+		},
+	}, nil
+}
+
+func readReminder(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	// template variables are matched as lists of values
+	var title string
+	switch v := request.Params.Arguments["title"].(type) {
+	case string:
+		title = v
+	case []string:
+		title = strings.Join(v, ",")
+	}
+
+	reminderList := loadReminders()
+	for _, reminder := range reminderList.Reminders {
+		if strings.ToLower(reminder.Title) == strings.ToLower(title) {
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "text/plain",
+					Text:     reminder.Content,
+				},
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no reminder titled %s", title)
+}
+
+func planReminders(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	instructions := "Help me plan my day around my reminders. Suggest an order and keep it short."
+	if focus := request.Params.Arguments["focus"]; focus != "" {
+		instructions += fmt.Sprintf(" Prioritize %s.", focus)
+	}
+
+	active, err := readActiveReminders(ctx, mcp.ReadResourceRequest{Params: mcp.ReadResourceParams{URI: activeRemindersURI}})
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewGetPromptResult("plan the day", []mcp.PromptMessage{
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(instructions)),
+		mcp.NewPromptMessage(mcp.RoleUser, mcp.EmbeddedResource{Type: "resource", Resource: active[0]}),
+	}), nil
+}
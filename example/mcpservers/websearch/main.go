@@ -5,7 +5,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -75,6 +79,18 @@ func main() {
 		return searchNews(ctx, search, request)
 	})
 
+	// summarizing asks the client's llm for the summary (MCP sampling), so no llm key is needed here
+	s.EnableSampling()
+	s.AddTool(mcp.NewTool("summarize_page",
+		mcp.WithDescription("fetches a web page and summarizes it"),
+		mcp.WithString("url",
+			mcp.Required(),
+			mcp.Description("The url of the page to summarize"),
+		),
+	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return summarizePage(ctx, s, request)
+	})
+
 	// Start the stdio server
 	if err := server.ServeStdio(s); err != nil {
 		fmt.Printf("Server error: %v\n", err)
@@ -83,7 +99,7 @@ func main() {
 }
 
 func searchWeb(ctx context.Context, search SearchProvider, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	query, ok := request.Params.Arguments["query"].(string)
+	query, ok := request.GetArguments()["query"].(string)
 	if !ok {
 		return nil, errors.New("the title must be a string")
 	}
@@ -97,7 +113,7 @@ func searchWeb(ctx context.Context, search SearchProvider, request mcp.CallToolR
 }
 
 func searchNews(ctx context.Context, search SearchProvider, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	query, ok := request.Params.Arguments["topic"].(string)
+	query, ok := request.GetArguments()["topic"].(string)
 	if !ok {
 		return nil, errors.New("topic must be a string")
 	}
@@ -109,3 +125,92 @@ func searchNews(ctx context.Context, search SearchProvider, request mcp.CallTool
 
 	return mcp.NewToolResultText(result), nil
 }
+
+// maxPageText bounds how much of a page is sent to the llm
+const maxPageText = 20000
+
+var (
+	htmlScripts = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	htmlTags    = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespace  = regexp.MustCompile(`\s+`)
+)
+
+// pageText fetches a page and strips it down to its text
+func pageText(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return "", err
+	}
+
+	text := htmlScripts.ReplaceAllString(string(data), " ")
+	text = htmlTags.ReplaceAllString(text, " ")
+	text = strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+	if len(text) > maxPageText {
+		text = text[:maxPageText]
+	}
+	return text, nil
+}
+
+// reportProgress tells the client how far along a tool call is, if it asked for progress
+func reportProgress(ctx context.Context, s *server.MCPServer, request mcp.CallToolRequest, progress float64, total float64, message string) {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return
+	}
+	s.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+		"progressToken": request.Params.Meta.ProgressToken,
+		"progress":      progress,
+		"total":         total,
+		"message":       message,
+	})
+}
+
+func summarizePage(ctx context.Context, s *server.MCPServer, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	url, ok := request.GetArguments()["url"].(string)
+	if !ok {
+		return nil, errors.New("url must be a string")
+	}
+
+	reportProgress(ctx, s, request, 0, 2, "fetching "+url)
+	text, err := pageText(url)
+	if err != nil {
+		return nil, err
+	}
+	s.SendLogMessageToClient(ctx, mcp.NewLoggingMessageNotification(mcp.LoggingLevelInfo, "websearch",
+		fmt.Sprintf("fetched %d characters from %s", len(text), url)))
+
+	reportProgress(ctx, s, request, 1, 2, "summarizing")
+
+	result, err := s.RequestSampling(ctx, mcp.CreateMessageRequest{
+		CreateMessageParams: mcp.CreateMessageParams{
+			Messages: []mcp.SamplingMessage{{
+				Role:    mcp.RoleUser,
+				Content: mcp.NewTextContent("Summarize this web page in a few sentences:\n\n" + text),
+			}},
+			SystemPrompt: "You summarize web pages accurately and briefly.",
+			MaxTokens:    500,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("the client could not summarize the page: %w", err)
+	}
+
+	if content, ok := result.Content.(mcp.TextContent); ok {
+		return mcp.NewToolResultText(content.Text), nil
+	}
+	if content, ok := result.Content.(map[string]any); ok {
+		if text, ok := content["text"].(string); ok {
+			return mcp.NewToolResultText(text), nil
+		}
+	}
+	return nil, errors.New("the client returned no summary")
+}
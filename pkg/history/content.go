@@ -0,0 +1,177 @@
+package history
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Resource describes a resource that was linked or embedded in a tool result
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	MIMEType    string `json:"mimeType,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Blob        string `json:"blob,omitempty"`
+}
+
+// NewToolResult converts the content returned by an MCP tool into a tool_result block.
+// Every MCP content type is flattened into the text, image, audio and resource fields
+// so that providers can render the result without knowing about MCP.
+func NewToolResult(toolUseID string, content []mcp.Content) ContentBlock {
+	block := ContentBlock{
+		Type:      "tool_result",
+		ToolUseID: toolUseID,
+		Content:   content,
+	}
+	block.Text = block.addContent(content)
+	return block
+}
+
+// NewPromptBlock converts the content of a prompt message returned by an MCP server into a text block
+func NewPromptBlock(content []mcp.Content) ContentBlock {
+	block := ContentBlock{
+		Type: "text",
+	}
+	block.Text = block.addContent(content)
+	return block
+}
+
+// addContent records the MCP content on the block and returns the text the LLM should see for it
+func (b *ContentBlock) addContent(content []mcp.Content) string {
+	var texts []string
+	for _, item := range content {
+		switch v := item.(type) {
+		case mcp.TextContent:
+			texts = append(texts, v.Text)
+
+		case mcp.ImageContent:
+			b.Images = append(b.Images, v.Data)
+
+		case mcp.AudioContent:
+			b.Audio = append(b.Audio, v.Data)
+			texts = append(texts, fmt.Sprintf("[audio clip (%s) returned to the user]", v.MIMEType))
+
+		case mcp.ResourceLink:
+			b.Resources = append(b.Resources, Resource{
+				URI:         v.URI,
+				Name:        v.Name,
+				Description: v.Description,
+				MIMEType:    v.MIMEType,
+			})
+			texts = append(texts, describeResourceLink(v))
+
+		case mcp.EmbeddedResource:
+			texts = append(texts, b.addEmbeddedResource(v.Resource))
+
+		default:
+			log.Warn("Unsupported MCP content", "type", fmt.Sprintf("%T", item))
+			texts = append(texts, fmt.Sprintf("[unsupported content type %T]", item))
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(texts, " "))
+}
+
+// NewResourceBlock converts the contents of a resource read from an MCP server into a text block
+// that can be attached to a message
+func NewResourceBlock(contents []mcp.ResourceContents) ContentBlock {
+	block := ContentBlock{
+		Type: "text",
+	}
+
+	var texts []string
+	for _, item := range contents {
+		texts = append(texts, block.addEmbeddedResource(item))
+	}
+	block.Text = strings.Join(texts, "\n")
+	return block
+}
+
+// NewToolError creates a tool_result block that reports a failed tool call back to the llm
+func NewToolError(toolUseID string, text string) ContentBlock {
+	block := NewToolResult(toolUseID, []mcp.Content{mcp.NewTextContent(text)})
+	block.IsError = true
+	return block
+}
+
+// DropMedia removes the images, audio and binary resources of the block, the text the llm saw of them stays.
+// It returns true if there was anything to remove.
+func (b *ContentBlock) DropMedia() bool {
+	dropped := len(b.Images) > 0 || len(b.Audio) > 0
+	b.Images = nil
+	b.Audio = nil
+
+	for i := range b.Resources {
+		if b.Resources[i].Blob != "" {
+			b.Resources[i].Blob = ""
+			dropped = true
+		}
+	}
+
+	if content, ok := b.Content.([]mcp.Content); ok {
+		kept := make([]mcp.Content, 0, len(content))
+		for _, item := range content {
+			switch v := item.(type) {
+			case mcp.ImageContent, mcp.AudioContent:
+				dropped = true
+				continue
+			case mcp.EmbeddedResource:
+				if _, ok := v.Resource.(mcp.BlobResourceContents); ok {
+					dropped = true
+					continue
+				}
+			}
+			kept = append(kept, item)
+		}
+		b.Content = kept
+	}
+	return dropped
+}
+
+func describeResourceLink(link mcp.ResourceLink) string {
+	text := fmt.Sprintf("[resource link: %s <%s>", link.Name, link.URI)
+	if link.Description != "" {
+		text += " " + link.Description
+	}
+	return text + "]"
+}
+
+// addEmbeddedResource records an embedded resource on the block and returns the text the LLM should see for it
+func (b *ContentBlock) addEmbeddedResource(contents mcp.ResourceContents) string {
+	switch r := contents.(type) {
+	case mcp.TextResourceContents:
+		b.Resources = append(b.Resources, Resource{
+			URI:      r.URI,
+			MIMEType: r.MIMEType,
+			Text:     r.Text,
+		})
+		return fmt.Sprintf("[resource <%s>]\n%s", r.URI, r.Text)
+
+	case mcp.BlobResourceContents:
+		switch {
+		case strings.HasPrefix(r.MIMEType, "image/"):
+			b.Images = append(b.Images, r.Blob)
+			return fmt.Sprintf("[image resource <%s>]", r.URI)
+
+		case strings.HasPrefix(r.MIMEType, "audio/"):
+			b.Audio = append(b.Audio, r.Blob)
+			return fmt.Sprintf("[audio resource <%s> returned to the user]", r.URI)
+		}
+
+		b.Resources = append(b.Resources, Resource{
+			URI:      r.URI,
+			MIMEType: r.MIMEType,
+			Blob:     r.Blob,
+		})
+		return fmt.Sprintf("[binary resource <%s> (%s, %d bytes)]", r.URI, r.MIMEType, base64.StdEncoding.DecodedLen(len(r.Blob)))
+
+	default:
+		log.Warn("Unsupported embedded resource", "type", fmt.Sprintf("%T", contents))
+		return fmt.Sprintf("[unsupported resource type %T]", contents)
+	}
+}
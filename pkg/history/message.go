@@ -4,11 +4,15 @@ import (
 	"encoding/json"
 	"strings"
 
+	"github.com/mark3labs/mcp-go/mcp"
+
 	"github.com/thirdmartini/mcpgw/pkg/llm"
 )
 
 // HistoryMessage implements the llm.message interface for stored messages
 type HistoryMessage struct {
+	// ID identifies the message within its conversation, it is set when the message is appended
+	ID      string         `json:"id,omitempty"`
 	Role    string         `json:"role"`
 	Content []ContentBlock `json:"content"`
 	Metrics llm.Metrics
@@ -37,6 +41,22 @@ func (m *HistoryMessage) GetImages() []string {
 	return images
 }
 
+func (m *HistoryMessage) GetAudio() []string {
+	var audio []string
+	for _, block := range m.Content {
+		audio = append(audio, block.Audio...)
+	}
+	return audio
+}
+
+func (m *HistoryMessage) GetResources() []Resource {
+	var resources []Resource
+	for _, block := range m.Content {
+		resources = append(resources, block.Resources...)
+	}
+	return resources
+}
+
 func (m *HistoryMessage) GetToolCalls() []llm.ToolCall {
 	var calls []llm.ToolCall
 	for _, block := range m.Content {
@@ -101,9 +121,53 @@ type ContentBlock struct {
 	Type      string          `json:"type"`
 	Text      string          `json:"text,omitempty"`
 	Images    []string        `json:"images,omitempty"`
+	Audio     []string        `json:"audio,omitempty"`
+	Resources []Resource      `json:"resources,omitempty"`
 	ID        string          `json:"id,omitempty"`
 	ToolUseID string          `json:"tool_use_id,omitempty"`
 	Name      string          `json:"name,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
 	Content   interface{}     `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// UnmarshalJSON restores the MCP content of tool results, other content is kept as decoded
+func (b *ContentBlock) UnmarshalJSON(data []byte) error {
+	type contentBlock ContentBlock
+	var block struct {
+		contentBlock
+		Content json.RawMessage `json:"content,omitempty"`
+	}
+	if err := json.Unmarshal(data, &block); err != nil {
+		return err
+	}
+
+	*b = ContentBlock(block.contentBlock)
+	if len(block.Content) == 0 {
+		return nil
+	}
+
+	if content, ok := unmarshalMCPContent(block.Content); ok {
+		b.Content = content
+		return nil
+	}
+	return json.Unmarshal(block.Content, &b.Content)
+}
+
+// unmarshalMCPContent decodes a list of MCP content, ok is false if the data is anything else
+func unmarshalMCPContent(data json.RawMessage) ([]mcp.Content, bool) {
+	var items []map[string]any
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, false
+	}
+
+	content := make([]mcp.Content, 0, len(items))
+	for _, item := range items {
+		c, err := mcp.ParseContent(item)
+		if err != nil {
+			return nil, false
+		}
+		content = append(content, c)
+	}
+	return content, true
 }
@@ -0,0 +1,74 @@
+package history
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestContentBlockRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []mcp.Content
+	}{
+		{"text", []mcp.Content{mcp.NewTextContent("hello")}},
+		{"image", []mcp.Content{mcp.NewImageContent("aGVsbG8=", "image/png")}},
+		{"audio", []mcp.Content{mcp.NewAudioContent("aGVsbG8=", "audio/wav")}},
+		{"resource_link", []mcp.Content{mcp.NewResourceLink("file:///notes.txt", "notes", "my notes", "text/plain")}},
+		{"embedded text resource", []mcp.Content{mcp.NewEmbeddedResource(mcp.TextResourceContents{
+			URI:      "file:///notes.txt",
+			MIMEType: "text/plain",
+			Text:     "remember the milk",
+		})}},
+		{"embedded blob resource", []mcp.Content{mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+			URI:      "file:///data.bin",
+			MIMEType: "application/octet-stream",
+			Blob:     "AAAA",
+		})}},
+		{"mixed", []mcp.Content{
+			mcp.NewTextContent("a picture"),
+			mcp.NewImageContent("aGVsbG8=", "image/png"),
+			mcp.NewResourceLink("file:///x", "x", "", "text/plain"),
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := NewToolResult("call-1", test.content)
+
+			data, err := json.Marshal(block)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+
+			var decoded ContentBlock
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			if !reflect.DeepEqual(decoded, block) {
+				t.Errorf("round trip changed the block\n got: %#v\nwant: %#v", decoded, block)
+			}
+		})
+	}
+}
+
+func TestContentBlockRoundTripPlainContent(t *testing.T) {
+	block := ContentBlock{Type: "tool_result", ToolUseID: "call-1", Content: "plain"}
+
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var decoded ContentBlock
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, block) {
+		t.Errorf("round trip changed the block\n got: %#v\nwant: %#v", decoded, block)
+	}
+}
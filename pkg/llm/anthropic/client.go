@@ -74,3 +74,24 @@ func (c *Client) CreateMessage(ctx context.Context, req CreateRequest) (*APIMess
 
 	return &message, nil
 }
+
+// ListModels queries the models endpoint, it is used to check that the api is reachable and the key is valid
+func (c *Client) ListModels(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/models", c.baseURL), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("X-Api-Key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error response with status %d", resp.StatusCode)
+	}
+	return nil
+}
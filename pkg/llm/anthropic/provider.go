@@ -2,12 +2,14 @@ package anthropic
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/charmbracelet/log"
-	
+
 	"github.com/thirdmartini/mcpgw/pkg/history"
 	"github.com/thirdmartini/mcpgw/pkg/llm"
 )
@@ -34,6 +36,21 @@ func (p *Provider) CreateMessage(
 	prompt string,
 	messages []llm.Message,
 	tools []llm.Tool,
+) (llm.Message, error) {
+	return p.createMessage(ctx, prompt, messages, tools, llm.CompletionOptions{})
+}
+
+// CreateCompletion sends the messages without tools, applying the per request options
+func (p *Provider) CreateCompletion(ctx context.Context, messages []llm.Message, options llm.CompletionOptions) (llm.Message, error) {
+	return p.createMessage(ctx, "", messages, nil, options)
+}
+
+func (p *Provider) createMessage(
+	ctx context.Context,
+	prompt string,
+	messages []llm.Message,
+	tools []llm.Tool,
+	options llm.CompletionOptions,
 ) (llm.Message, error) {
 	log.Debug("creating message",
 		"prompt", prompt,
@@ -81,7 +98,8 @@ func (p *Provider) CreateMessage(
 						content = append(content, ContentBlock{
 							Type:      "tool_result",
 							ToolUseID: block.ToolUseID,
-							Content:   block.Content,
+							Content:   toolResultContent(block),
+							IsError:   block.IsError,
 						})
 					}
 				}
@@ -132,14 +150,24 @@ func (p *Provider) CreateMessage(
 		"messages", anthropicMessages,
 		"num_tools", len(tools))
 
+	request := CreateRequest{
+		Model:         p.model,
+		Messages:      anthropicMessages,
+		MaxTokens:     4096,
+		Tools:         anthropicTools,
+		System:        p.systemPrompt,
+		Temperature:   options.Temperature,
+		StopSequences: options.StopSequences,
+	}
+	if options.MaxTokens > 0 {
+		request.MaxTokens = options.MaxTokens
+	}
+	if options.SystemPrompt != "" {
+		request.System = options.SystemPrompt
+	}
+
 	// Make the API call
-	resp, err := p.client.CreateMessage(ctx, CreateRequest{
-		Model:     p.model,
-		Messages:  anthropicMessages,
-		MaxTokens: 4096,
-		Tools:     anthropicTools,
-		System:    p.systemPrompt,
-	})
+	resp, err := p.client.CreateMessage(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -155,6 +183,15 @@ func (p *Provider) Name() string {
 	return "anthropic"
 }
 
+func (p *Provider) Model() string {
+	return p.model
+}
+
+// CheckHealth checks that the api is reachable and accepts our key
+func (p *Provider) CheckHealth(ctx context.Context) error {
+	return p.client.ListModels(ctx)
+}
+
 func (p *Provider) CreateToolResponse(
 	toolCallID string,
 	content interface{},
@@ -197,6 +234,34 @@ func (p *Provider) CreateToolResponse(
 	return msg, nil
 }
 
+// toolResultContent renders a stored tool result as the text and image blocks the messages api accepts
+func toolResultContent(block history.ContentBlock) []ContentBlock {
+	var content []ContentBlock
+	if block.Text != "" {
+		content = append(content, ContentBlock{
+			Type: "text",
+			Text: block.Text,
+		})
+	}
+
+	for _, image := range block.Images {
+		data, err := base64.StdEncoding.DecodeString(image)
+		if err != nil {
+			log.Warn("skipping undecodable tool result image", "error", err)
+			continue
+		}
+		content = append(content, ContentBlock{
+			Type: "image",
+			Source: &ImageSource{
+				Type:      "base64",
+				MediaType: http.DetectContentType(data),
+				Data:      image,
+			},
+		})
+	}
+	return content
+}
+
 const (
 	roleUser      = "user"
 	roleAssistant = "assistant"
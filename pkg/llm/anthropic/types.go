@@ -11,11 +11,13 @@ import (
 )
 
 type CreateRequest struct {
-	Model     string         `json:"model"`
-	Messages  []MessageParam `json:"messages"`
-	MaxTokens int            `json:"max_tokens"`
-	System    string         `json:"system,omitempty"`
-	Tools     []Tool         `json:"tools,omitempty"`
+	Model         string         `json:"model"`
+	Messages      []MessageParam `json:"messages"`
+	MaxTokens     int            `json:"max_tokens"`
+	System        string         `json:"system,omitempty"`
+	Tools         []Tool         `json:"tools,omitempty"`
+	Temperature   float64        `json:"temperature,omitempty"`
+	StopSequences []string       `json:"stop_sequences,omitempty"`
 }
 
 type MessageParam struct {
@@ -31,6 +33,14 @@ type ContentBlock struct {
 	Name      string          `json:"name,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
 	Content   interface{}     `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	Source    *ImageSource    `json:"source,omitempty"`
+}
+
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
 }
 
 type Tool struct {
@@ -188,6 +198,14 @@ func (t *ToolCall) GetArguments() map[string]interface{} {
 	return args
 }
 
+func (t *ToolCall) ArgumentsError() error {
+	if len(t.args) == 0 {
+		return nil
+	}
+	var args map[string]interface{}
+	return json.Unmarshal(t.args, &args)
+}
+
 func (t *ToolCall) GetID() string {
 	return t.id
 }
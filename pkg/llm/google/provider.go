@@ -15,7 +15,6 @@ import (
 type Provider struct {
 	client *genai.Client
 	model  *genai.GenerativeModel
-	chat   *genai.ChatSession
 
 	toolCallID int
 }
@@ -33,11 +32,19 @@ func NewProvider(ctx context.Context, apiKey, model, systemPrompt string) (*Prov
 	return &Provider{
 		client: client,
 		model:  m,
-		chat:   m.StartChat(),
 	}, nil
 }
 
 func (p *Provider) CreateMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool) (llm.Message, error) {
+	return p.createMessage(ctx, messages, tools, llm.CompletionOptions{})
+}
+
+// CreateCompletion sends the messages without tools, applying the per request options
+func (p *Provider) CreateCompletion(ctx context.Context, messages []llm.Message, options llm.CompletionOptions) (llm.Message, error) {
+	return p.createMessage(ctx, messages, nil, options)
+}
+
+func (p *Provider) createMessage(ctx context.Context, messages []llm.Message, tools []llm.Tool, options llm.CompletionOptions) (llm.Message, error) {
 	var hist []*genai.Content
 	for _, msg := range messages {
 		for _, call := range msg.GetToolCalls() {
@@ -73,9 +80,11 @@ func (p *Provider) CreateMessage(ctx context.Context, prompt string, messages []
 		}
 	}
 
-	p.model.Tools = nil
+	// every request gets a copy of the model so the tools and options of one don't leak into the next
+	model := *p.model
+	model.Tools = nil
 	for _, tool := range tools {
-		p.model.Tools = append(p.model.Tools, &genai.Tool{
+		model.Tools = append(model.Tools, &genai.Tool{
 			FunctionDeclarations: []*genai.FunctionDeclaration{
 				{
 					Name:        tool.Name,
@@ -86,10 +95,24 @@ func (p *Provider) CreateMessage(ctx context.Context, prompt string, messages []
 		})
 	}
 
-	p.chat.History = hist
+	if options.SystemPrompt != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(options.SystemPrompt))
+	}
+	if options.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(options.MaxTokens))
+	}
+	if options.Temperature > 0 {
+		model.SetTemperature(float32(options.Temperature))
+	}
+	if len(options.StopSequences) > 0 {
+		model.StopSequences = options.StopSequences
+	}
+
+	chat := model.StartChat()
+	chat.History = hist
 	// The provided messages slice (and thus history) already includes the new prompt,
 	// so we just call SendMessage with an empty string that will be trimmed by the server.
-	resp, err := p.chat.SendMessage(ctx, genai.Text(""))
+	resp, err := chat.SendMessage(ctx, genai.Text(""))
 	if err != nil {
 		return nil, err
 	}
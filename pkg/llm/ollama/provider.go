@@ -10,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/log"
-	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/ollama/ollama/api"
 
 	"github.com/thirdmartini/mcpgw/pkg/history"
@@ -60,26 +59,19 @@ func (p *Provider) convertMessages(prompt string, messages []llm.Message) []api.
 			// Handle HistoryMessage format
 			if historyMsg, ok := msg.(*history.HistoryMessage); ok {
 				for _, block := range historyMsg.Content {
-					if mcpContent, ok := block.Content.([]mcp.Content); ok {
-						for _, c := range mcpContent {
-							switch v := c.(type) {
-							case mcp.ImageContent:
-								imageDataRaw, err := base64.StdEncoding.DecodeString(v.Data)
-								if err != nil {
-									continue
-								}
-								imageContent = append(imageContent, api.ImageData(imageDataRaw))
-
-							case mcp.TextContent:
-								// We sometimes see a result of Text:"somedata",Image:"image data",Text:""
-								content += v.Text + " "
-
-							default:
-								panic(fmt.Sprintf("unsupported content type: %T", v))
-							}
+					if block.Type != "tool_result" {
+						continue
+					}
+					for _, image := range block.Images {
+						imageDataRaw, err := base64.StdEncoding.DecodeString(image)
+						if err != nil {
+							continue
 						}
-					} else {
-						log.Fatalf("not mcp content %T\n", block.Content)
+						imageContent = append(imageContent, api.ImageData(imageDataRaw))
+					}
+					// We sometimes see a result of Text:"somedata",Image:"image data",Text:""
+					if block.Text != "" {
+						content += block.Text + " "
 					}
 				}
 			}
@@ -89,13 +81,13 @@ func (p *Provider) convertMessages(prompt string, messages []llm.Message) []api.
 				content = msg.GetContent()
 			}
 
-			if content == "" {
+			if content == "" && len(imageContent) == 0 {
 				continue
 			}
 
 			ollamaMsg := api.Message{
 				Role:    "tool",
-				Content: content,
+				Content: strings.TrimSpace(content),
 				Images:  imageContent,
 			}
 			ollamaMessages = append(ollamaMessages, ollamaMsg)
@@ -210,10 +202,29 @@ func (p *Provider) CreateMessage(
 	prompt string,
 	messages []llm.Message,
 	tools []llm.Tool,
+) (llm.Message, error) {
+	return p.createMessage(ctx, prompt, messages, tools, llm.CompletionOptions{})
+}
+
+// CreateCompletion sends the messages without tools, applying the per request options
+func (p *Provider) CreateCompletion(ctx context.Context, messages []llm.Message, options llm.CompletionOptions) (llm.Message, error) {
+	return p.createMessage(ctx, "", messages, nil, options)
+}
+
+func (p *Provider) createMessage(
+	ctx context.Context,
+	prompt string,
+	messages []llm.Message,
+	tools []llm.Tool,
+	options llm.CompletionOptions,
 ) (llm.Message, error) {
 	ollamaMessages := p.convertMessages(prompt, messages)
 	ollamaTools := p.convertTools(tools)
 
+	if options.SystemPrompt != "" {
+		ollamaMessages = append([]api.Message{{Role: "system", Content: options.SystemPrompt}}, ollamaMessages...)
+	}
+
 	// Convert generic messages to Ollama format
 	log.Debug("creating message",
 		"prompt", prompt,
@@ -235,6 +246,15 @@ func (p *Provider) CreateMessage(
 			// "num_gpu": 0, // this will disable gpu usage and make things terribly slow
 		},
 	}
+	if options.MaxTokens > 0 {
+		request.Options["num_predict"] = options.MaxTokens
+	}
+	if options.Temperature > 0 {
+		request.Options["temperature"] = options.Temperature
+	}
+	if len(options.StopSequences) > 0 {
+		request.Options["stop"] = options.StopSequences
+	}
 
 	response := &Message{}
 	err := p.client.Chat(ctx, &request, func(r api.ChatResponse) error {
@@ -267,6 +287,15 @@ func (p *Provider) Name() string {
 	return "ollama"
 }
 
+func (p *Provider) Model() string {
+	return p.model
+}
+
+// CheckHealth checks that the ollama server is up
+func (p *Provider) CheckHealth(ctx context.Context) error {
+	return p.client.Heartbeat(ctx)
+}
+
 func (p *Provider) CreateToolResponse(
 	toolCallID string,
 	content interface{},
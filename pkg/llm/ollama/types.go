@@ -15,6 +15,7 @@ type Message struct {
 	metrics    api.Metrics
 	message    api.Message
 	ToolCallID string // Store tool call ID separately since Ollama API doesn't have this field
+	toolCalls  []llm.ToolCall
 }
 
 func (m *Message) GetRole() string {
@@ -27,11 +28,13 @@ func (m *Message) GetContent() string {
 }
 
 func (m *Message) GetToolCalls() []llm.ToolCall {
-	var calls []llm.ToolCall
-	for _, call := range m.message.ToolCalls {
-		calls = append(calls, NewOllamaToolCall(call))
+	// Ollama does not assign ids to tool calls, wrap them once so the generated ids stay stable
+	if m.toolCalls == nil {
+		for _, call := range m.message.ToolCalls {
+			m.toolCalls = append(m.toolCalls, NewOllamaToolCall(call))
+		}
 	}
-	return calls
+	return m.toolCalls
 }
 
 func (m *Message) GetMetrics() llm.Metrics {
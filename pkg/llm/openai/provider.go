@@ -45,6 +45,21 @@ func (p *Provider) CreateMessage(
 	prompt string,
 	messages []llm.Message,
 	tools []llm.Tool,
+) (llm.Message, error) {
+	return p.createMessage(ctx, prompt, messages, tools, llm.CompletionOptions{})
+}
+
+// CreateCompletion sends the messages without tools, applying the per request options
+func (p *Provider) CreateCompletion(ctx context.Context, messages []llm.Message, options llm.CompletionOptions) (llm.Message, error) {
+	return p.createMessage(ctx, "", messages, nil, options)
+}
+
+func (p *Provider) createMessage(
+	ctx context.Context,
+	prompt string,
+	messages []llm.Message,
+	tools []llm.Tool,
+	options llm.CompletionOptions,
 ) (llm.Message, error) {
 	log.Debug("creating message",
 		"prompt", prompt,
@@ -54,10 +69,14 @@ func (p *Provider) CreateMessage(
 	openaiMessages := make([]MessageParam, 0, len(messages))
 
 	// Add system prompt if provided
-	if p.systemPrompt != "" {
+	systemPrompt := p.systemPrompt
+	if options.SystemPrompt != "" {
+		systemPrompt = options.SystemPrompt
+	}
+	if systemPrompt != "" {
 		openaiMessages = append(openaiMessages, MessageParam{
 			Role:    "system",
-			Content: &p.systemPrompt,
+			Content: &systemPrompt,
 		})
 	}
 
@@ -179,14 +198,23 @@ func (p *Provider) CreateMessage(
 
 	log.Infof("Using model: %s\n", p.model)
 
-	// Make the API call
-	resp, err := p.client.CreateChatCompletion(ctx, CreateRequest{
+	request := CreateRequest{
 		Model:       p.model,
 		Messages:    openaiMessages,
 		Tools:       openaiTools,
 		MaxTokens:   4096,
 		Temperature: 0.7,
-	})
+		Stop:        options.StopSequences,
+	}
+	if options.MaxTokens > 0 {
+		request.MaxTokens = options.MaxTokens
+	}
+	if options.Temperature > 0 {
+		request.Temperature = float32(options.Temperature)
+	}
+
+	// Make the API call
+	resp, err := p.client.CreateChatCompletion(ctx, request)
 	if err != nil {
 		log.Infof("openai: %v [%+v]\n", err, resp)
 		return nil, err
@@ -207,6 +235,15 @@ func (p *Provider) Name() string {
 	return "openai"
 }
 
+func (p *Provider) Model() string {
+	return p.model
+}
+
+// CheckHealth checks that the api is reachable and accepts our key
+func (p *Provider) CheckHealth(ctx context.Context) error {
+	return p.client.ListModels(ctx)
+}
+
 func (p *Provider) CreateToolResponse(
 	toolCallID string,
 	content interface{},
@@ -350,6 +387,14 @@ func (t *ToolCallWrapper) GetName() string {
 	return t.Call.Function.Name
 }
 
+func (t *ToolCallWrapper) ArgumentsError() error {
+	if strings.TrimSpace(t.Call.Function.Arguments) == "" {
+		return nil
+	}
+	var args map[string]interface{}
+	return json.Unmarshal([]byte(t.Call.Function.Arguments), &args)
+}
+
 func (t *ToolCallWrapper) GetArguments() map[string]interface{} {
 	var args map[string]interface{}
 	if err := json.Unmarshal([]byte(t.Call.Function.Arguments), &args); err != nil {
@@ -6,6 +6,7 @@ type CreateRequest struct {
 	Tools       []Tool         `json:"tools,omitempty"`
 	MaxTokens   int            `json:"max_tokens,omitempty"`
 	Temperature float32        `json:"temperature,omitempty"`
+	Stop        []string       `json:"stop,omitempty"`
 }
 
 type MessageParam struct {
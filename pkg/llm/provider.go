@@ -42,6 +42,20 @@ type ToolCall interface {
 	GetID() string
 }
 
+// ArgumentsErrorer is implemented by tool calls that can report why their raw arguments could not be decoded
+type ArgumentsErrorer interface {
+	// ArgumentsError returns the error decoding the arguments, nil if they are valid
+	ArgumentsError() error
+}
+
+// ToolCallArgumentsError returns the decoding error of the call's arguments, if the provider reports one
+func ToolCallArgumentsError(call ToolCall) error {
+	if e, ok := call.(ArgumentsErrorer); ok {
+		return e.ArgumentsError()
+	}
+	return nil
+}
+
 // Tool represents a tool definition
 type Tool struct {
 	Name        string `json:"name"`
@@ -71,6 +85,56 @@ type Provider interface {
 	Name() string
 }
 
+// HealthChecker is implemented by providers that can check whether their backend is reachable
+type HealthChecker interface {
+	// CheckHealth returns an error if the backend can not be reached
+	CheckHealth(ctx context.Context) error
+}
+
+// CheckHealth checks the backend of the provider, providers that can't be checked are assumed healthy
+func CheckHealth(ctx context.Context, p Provider) error {
+	if c, ok := p.(HealthChecker); ok {
+		return c.CheckHealth(ctx)
+	}
+	return nil
+}
+
+// CompletionOptions tune a single completion, zero values keep the provider's defaults
+type CompletionOptions struct {
+	SystemPrompt  string
+	MaxTokens     int
+	Temperature   float64
+	StopSequences []string
+}
+
+// Completer is implemented by providers that can run a completion with per request options
+type Completer interface {
+	// CreateCompletion sends the messages to the LLM without tools and returns the response
+	CreateCompletion(ctx context.Context, messages []Message, options CompletionOptions) (Message, error)
+}
+
+// Complete runs a completion without tools. Every bundled provider implements Completer, other providers
+// are called through CreateMessage and ignore the options.
+func Complete(ctx context.Context, p Provider, messages []Message, options CompletionOptions) (Message, error) {
+	if c, ok := p.(Completer); ok {
+		return c.CreateCompletion(ctx, messages, options)
+	}
+	return p.CreateMessage(ctx, "", messages, nil)
+}
+
+// Modeler is implemented by providers that can tell which model they use
+type Modeler interface {
+	Model() string
+}
+
+// ModelName returns the model used by the provider, or the provider's name if it can't tell
+func ModelName(p Provider) string {
+	if m, ok := p.(Modeler); ok {
+		return m.Model()
+	}
+	return p.Name()
+}
+
 type Metrics struct {
 	InputTokenCount  int
 	InputEvalTime    time.Duration
@@ -0,0 +1,124 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+)
+
+// ErrNoPendingApproval is returned when resolving a tool call that is not waiting for approval
+var ErrNoPendingApproval = errors.New("no pending approval for tool call")
+
+const declinedToolResult = "The user declined to run this tool call."
+
+// ApprovalPolicy decides which tools of a server need the user's approval before they run.
+// In the config it is either a boolean that covers every tool of the server or a list of tool names.
+type ApprovalPolicy struct {
+	All   bool
+	Tools []string
+}
+
+func (p *ApprovalPolicy) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &p.All); err == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &p.Tools); err != nil {
+		return fmt.Errorf("requireApproval must be a boolean or a list of tool names: %w", err)
+	}
+	return nil
+}
+
+func (p ApprovalPolicy) MarshalJSON() ([]byte, error) {
+	if p.All || len(p.Tools) == 0 {
+		return json.Marshal(p.All)
+	}
+	return json.Marshal(p.Tools)
+}
+
+// Requires returns true if calling tool needs the user's approval
+func (p *ApprovalPolicy) Requires(tool string) bool {
+	if p == nil {
+		return false
+	}
+	if p.All {
+		return true
+	}
+	for _, t := range p.Tools {
+		if t == tool {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingToolCall is a tool call requested by the llm that is waiting for the user to approve or deny it
+type PendingToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Server    string          `json:"server"`
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	Requested time.Time       `json:"requested"`
+}
+
+func (h *Host) requiresApproval(serverName, toolName string) bool {
+	options, ok := h.serverOptions(serverName)
+	if !ok {
+		return false
+	}
+	return options.RequireApproval.Requires(toolName)
+}
+
+func declinedResult(toolUseID string) history.ContentBlock {
+	return history.NewToolResult(toolUseID, []mcp.Content{mcp.NewTextContent(declinedToolResult)})
+}
+
+// ResolveApproval approves or denies a pending tool call of the conversation.
+// An approved call runs against its server, a denied call is answered with a "user declined" result.
+// Once nothing is left pending the llm is called again to continue the turn.
+func (h *Host) ResolveApproval(ctx context.Context, conversation *Conversation, id string, approved bool) error {
+	call, ok := conversation.takePending(id)
+	if !ok {
+		return ErrNoPendingApproval
+	}
+
+	log.Info("Tool call resolved", "tool", call.Name, "id", call.ID, "approved", approved)
+
+	result := declinedResult(call.ID)
+	if approved {
+		result = h.callTool(withConversation(ctx, conversation.Id), call.ID, call.Name, call.Arguments)
+	}
+
+	conversation.Append(history.HistoryMessage{
+		Role:    "tool",
+		Content: []history.ContentBlock{result},
+	})
+
+	if len(conversation.Pending) > 0 || len(conversation.ClientToolCalls()) > 0 {
+		return nil
+	}
+
+	log.Infof("Calling LLM to interpret tool results")
+	return h.runPromptNonInteractive(ctx, "", conversation)
+}
+
+// declinePending answers every pending tool call as declined, this keeps the history valid
+// when the user moves on with a new prompt instead of approving the calls
+func (h *Host) declinePending(conversation *Conversation) {
+	for _, call := range conversation.Pending {
+		log.Info("Tool call declined by new prompt", "tool", call.Name, "id", call.ID)
+		conversation.Append(history.HistoryMessage{
+			Role:    "tool",
+			Content: []history.ContentBlock{declinedResult(call.ID)},
+		})
+	}
+	conversation.Pending = nil
+}
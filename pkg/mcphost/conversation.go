@@ -1,13 +1,41 @@
 package mcphost
 
 import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
 	"github.com/thirdmartini/mcpgw/pkg/history"
+	"github.com/thirdmartini/mcpgw/pkg/llm"
 )
 
 type Conversation struct {
-	Id       string
-	Messages []history.HistoryMessage
-	Window   int
+	Id       string                   `json:"id"`
+	Title    string                   `json:"title,omitempty"`
+	Created  time.Time                `json:"created"`
+	Updated  time.Time                `json:"updated"`
+	Messages []history.HistoryMessage `json:"messages"`
+	Window   int                      `json:"window"`
+
+	// Recap sums up the messages that fell out of the window, it is kept in a system message after the system prompt
+	Recap string `json:"recap,omitempty"`
+
+	// Branch is the id of the active branch, Branches the tree of histories created by editing or regenerating
+	// earlier messages. Conversations that were never branched have none.
+	Branch   string   `json:"branch,omitempty"`
+	Branches []Branch `json:"branches,omitempty"`
+
+	// Pending holds the tool calls of the last llm reply that are waiting for the user's approval
+	Pending []PendingToolCall `json:"pending,omitempty"`
+
+	// ClientTools are tools the caller runs itself. The llm is offered them next to the gateway's tools,
+	// calls to them end the turn and are left for the caller to answer. They only last for one request.
+	ClientTools []llm.Tool `json:"-"`
+
+	// turn is the request working on this copy of the conversation
+	turn *conversationTurn
 }
 
 func (s *Conversation) Prune() {
@@ -20,12 +48,20 @@ func (s *Conversation) pruneMessages(messages []history.HistoryMessage) []histor
 	}
 
 	// Keep only the most recent Messages based on Window size
-	messages = messages[len(messages)-s.Window:]
+	return s.dropOrphans(messages[len(messages)-s.Window:])
+}
 
+// dropOrphans removes tool uses without results and results without uses, cutting the history can leave them behind
+func (s *Conversation) dropOrphans(messages []history.HistoryMessage) []history.HistoryMessage {
 	// Handle Messages
 	toolUseIds := make(map[string]bool)
 	toolResultIds := make(map[string]bool)
 
+	// Tool calls waiting for approval will get their result later, don't treat them as orphaned
+	for _, call := range s.Pending {
+		toolResultIds[call.ID] = true
+	}
+
 	// First pass: collect all tool use and result IDs
 	for _, msg := range messages {
 		for _, block := range msg.Content {
@@ -71,8 +107,162 @@ func (s *Conversation) pruneMessages(messages []history.HistoryMessage) []histor
 	return prunedMessages
 }
 
+// size returns how many bytes the active branch of the conversation takes when stored,
+// the branches that are put away are limited on their own
+func (s *Conversation) size() int {
+	active := *s
+	active.Branches = nil
+	data, err := json.Marshal(&active)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// limitSize cuts the conversation down to maxBytes and returns its new size. The media of all but the
+// latest message goes first as base64 images and audio take the most room, then the oldest messages.
+// The system prompt and the latest message are always kept.
+func (s *Conversation) limitSize(maxBytes int) int {
+	size := s.size()
+	for i := 0; i < len(s.Messages)-1 && size > maxBytes; i++ {
+		dropped := false
+		for j := range s.Messages[i].Content {
+			dropped = s.Messages[i].Content[j].DropMedia() || dropped
+		}
+		if dropped {
+			size = s.size()
+		}
+	}
+
+	for size > maxBytes {
+		first := 0
+		for first < len(s.Messages) && s.Messages[first].Role == "system" {
+			first++
+		}
+		if first >= len(s.Messages)-1 {
+			break
+		}
+
+		messages := append(s.Messages[:first:first], s.Messages[first+1:]...)
+		s.Messages = s.dropOrphans(messages)
+		size = s.size()
+	}
+	return size
+}
+
+// isSummary returns true if the message carries the conversation's summary
+func (s *Conversation) isSummary(message history.HistoryMessage) bool {
+	return s.Recap != "" && message.Role == "system" && len(message.Content) == 1 &&
+		message.Content[0].Text == summaryHeader+s.Recap
+}
+
+// clone copies the conversation so a turn can change it while readers keep seeing the stored version
+func (s *Conversation) clone() *Conversation {
+	conversation := *s
+	conversation.Messages = cloneMessages(s.Messages)
+	conversation.Pending = slices.Clone(s.Pending)
+	conversation.Branches = slices.Clone(s.Branches)
+	for i := range conversation.Branches {
+		conversation.Branches[i].Messages = cloneMessages(s.Branches[i].Messages)
+		conversation.Branches[i].Pending = slices.Clone(s.Branches[i].Pending)
+	}
+	conversation.ClientTools = nil
+	conversation.turn = nil
+	return &conversation
+}
+
+// cloneMessages copies messages down to the parts that trimming changes in place
+func cloneMessages(messages []history.HistoryMessage) []history.HistoryMessage {
+	if messages == nil {
+		return nil
+	}
+
+	cloned := make([]history.HistoryMessage, len(messages))
+	for i, message := range messages {
+		message.Content = slices.Clone(message.Content)
+		for j := range message.Content {
+			message.Content[j].Resources = slices.Clone(message.Content[j].Resources)
+		}
+		cloned[i] = message
+	}
+	return cloned
+}
+
 func (s *Conversation) Append(message history.HistoryMessage) {
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
 	s.Messages = append(s.Messages, message)
+	s.Updated = time.Now()
+}
+
+// ConversationSummary describes a conversation without its messages
+type ConversationSummary struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Messages int       `json:"messageCount"`
+}
+
+// Summary describes the conversation, the system prompt doesn't count as a message
+func (s *Conversation) Summary() ConversationSummary {
+	summary := ConversationSummary{
+		ID:      s.Id,
+		Title:   s.Title,
+		Created: s.Created,
+		Updated: s.Updated,
+	}
+	for _, message := range s.Messages {
+		if message.Role != "system" {
+			summary.Messages++
+		}
+	}
+	return summary
+}
+
+// takePending removes the pending tool call with the given id and returns it
+func (s *Conversation) takePending(id string) (PendingToolCall, bool) {
+	for i, call := range s.Pending {
+		if call.ID == id {
+			s.Pending = append(s.Pending[:i], s.Pending[i+1:]...)
+			return call, true
+		}
+	}
+	return PendingToolCall{}, false
+}
+
+// isClientTool returns true if name is one of the caller's tools
+func (s *Conversation) isClientTool(name string) bool {
+	for _, tool := range s.ClientTools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientToolCalls returns the calls of the last llm reply to the caller's tools that have no result yet
+func (s *Conversation) ClientToolCalls() []history.ContentBlock {
+	answered := make(map[string]bool)
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		message := s.Messages[i]
+		if message.IsToolResponse() {
+			for _, block := range message.Content {
+				answered[block.ToolUseID] = true
+			}
+			continue
+		}
+
+		var calls []history.ContentBlock
+		for _, block := range message.Content {
+			if block.Type == "tool_use" && s.isClientTool(block.Name) && !answered[block.ID] {
+				calls = append(calls, block)
+			}
+		}
+		return calls
+	}
+	return nil
 }
 
 func (s *Conversation) LastReply() *history.HistoryMessage {
@@ -80,24 +270,41 @@ func (s *Conversation) LastReply() *history.HistoryMessage {
 }
 
 func (s *Conversation) LastResponse() *ChatResponse {
-	history := s.Messages[len(s.Messages)-1]
+	// while calls wait for approval the turn ends on the results of the calls that ran right away,
+	// the reply is the llm's message that asked for them
+	reply := len(s.Messages) - 1
+	if len(s.Pending) > 0 {
+		for reply > 0 && s.Messages[reply].IsToolResponse() {
+			reply--
+		}
+	}
+	message := s.Messages[reply]
 
 	response := &ChatResponse{
-		Message: history.GetContent(),
-		Images:  history.GetImages(),
-		Metrics: history.GetMetrics(),
-	}
-	// check to see if the previous previous history has an image content block
-
-	if len(response.Images) == 0 {
-		// check history 1 back
-		if len(s.Messages)-2 >= 0 {
-			history = s.Messages[len(s.Messages)-2]
-			if history.IsToolResponse() {
-				response.Images = history.GetImages()
-			}
+		Message: message.GetContent(),
+		Pending: s.Pending,
+		Metrics: message.GetMetrics(),
+	}
+
+	// walk back over the tool results that led to this reply, and on to the ones after it, to surface their media
+	first := reply
+	for first > 0 && s.Messages[first-1].IsToolResponse() {
+		first--
+	}
+	results := append(slices.Clone(s.Messages[first:reply]), s.Messages[reply+1:]...)
+
+	images := message.GetImages()
+	fromTools := len(images) == 0
+	for _, result := range results {
+		if fromTools {
+			response.Images = append(response.Images, result.GetImages()...)
 		}
+		response.Audio = append(response.Audio, result.GetAudio()...)
+		response.Resources = append(response.Resources, result.GetResources()...)
 	}
+	response.Images = append(response.Images, images...)
+	response.Audio = append(response.Audio, message.GetAudio()...)
+	response.Resources = append(response.Resources, message.GetResources()...)
 
 	return response
 }
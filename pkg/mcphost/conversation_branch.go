@@ -0,0 +1,280 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+)
+
+var (
+	// ErrUnknownMessage is returned when a message id is not part of the active branch
+	ErrUnknownMessage = errors.New("unknown message")
+
+	// ErrUnknownBranch is returned when switching to a branch the conversation doesn't have
+	ErrUnknownBranch = errors.New("unknown branch")
+
+	// ErrWrongRole is returned when editing a message that isn't the user's or regenerating one that isn't the llm's
+	ErrWrongRole = errors.New("message can't be changed this way")
+)
+
+// Branch is one history of a conversation. A branch starts as a copy of its parent up to the message it
+// replaces, the branches of a conversation form a tree rooted at its original history.
+type Branch struct {
+	ID      string    `json:"id"`
+	Parent  string    `json:"parent,omitempty"`
+	Created time.Time `json:"created"`
+
+	// Fork is the id of the message of the parent that the branch replaced
+	Fork string `json:"fork,omitempty"`
+
+	// the history of the branch while it isn't active, the active branch's is the conversation's
+	Messages []history.HistoryMessage `json:"messages,omitempty"`
+	Recap    string                   `json:"recap,omitempty"`
+	Pending  []PendingToolCall        `json:"pending,omitempty"`
+}
+
+// BranchSummary describes a branch without its messages
+type BranchSummary struct {
+	ID       string    `json:"id"`
+	Parent   string    `json:"parent,omitempty"`
+	Fork     string    `json:"fork,omitempty"`
+	Created  time.Time `json:"created"`
+	Active   bool      `json:"active"`
+	Messages int       `json:"messageCount"`
+
+	// Preview is the last user message of the branch
+	Preview string `json:"preview"`
+}
+
+// assignIDs gives the messages of conversations stored before messages had ids one
+func (s *Conversation) assignIDs() {
+	for i := range s.Messages {
+		if s.Messages[i].ID == "" {
+			s.Messages[i].ID = uuid.New().String()
+		}
+	}
+}
+
+// findMessage returns the index of a message of the active branch
+func (s *Conversation) findMessage(id string) (int, bool) {
+	for i, message := range s.Messages {
+		if message.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// findBranch returns the index of a branch
+func (s *Conversation) findBranch(id string) (int, bool) {
+	for i, branch := range s.Branches {
+		if branch.ID == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// stash puts the history of the active branch away in its branch, the original history becomes the root branch
+func (s *Conversation) stash() {
+	if s.Branch == "" {
+		s.Branch = uuid.New().String()
+		s.Branches = append(s.Branches, Branch{ID: s.Branch, Created: s.Created})
+	}
+
+	i, _ := s.findBranch(s.Branch)
+	s.Branches[i].Messages = s.Messages
+	s.Branches[i].Recap = s.Recap
+	s.Branches[i].Pending = s.Pending
+}
+
+// fork starts a new branch that keeps the messages before index, the message at index and the ones after it
+// stay with the branch that is put away
+func (s *Conversation) fork(index int) {
+	fork := s.Messages[index].ID
+	s.stash()
+
+	branch := Branch{
+		ID:      uuid.New().String(),
+		Parent:  s.Branch,
+		Fork:    fork,
+		Created: time.Now(),
+	}
+	s.Branches = append(s.Branches, branch)
+	s.Branch = branch.ID
+
+	s.Messages = slices.Clone(s.Messages[:index])
+	s.Pending = nil
+	s.Updated = time.Now()
+	log.Info("Conversation branched", "session", s.Id, "branch", branch.ID, "parent", branch.Parent, "fork", fork)
+}
+
+// branchAndRun forks the conversation at index and runs the turn of the new branch. If the turn fails the fork
+// is undone, the conversation is left on the branch it was on without the new one.
+func (h *Host) branchAndRun(ctx context.Context, conversation *Conversation, index int, message *history.HistoryMessage) error {
+	saved := conversation.clone()
+
+	conversation.fork(index)
+	if message != nil {
+		conversation.Append(*message)
+	}
+	if err := h.RunPrompt(ctx, "", conversation); err != nil {
+		conversation.Messages = saved.Messages
+		conversation.Recap = saved.Recap
+		conversation.Pending = saved.Pending
+		conversation.Branch = saved.Branch
+		conversation.Branches = saved.Branches
+		conversation.Updated = saved.Updated
+		log.Warn("Conversation branch dropped, its turn failed", "session", conversation.Id, "error", err)
+		return err
+	}
+	return nil
+}
+
+// stashed returns a branch that is put away as a conversation of its own, so it can be pruned and trimmed
+func (s *Conversation) stashed(branch Branch) *Conversation {
+	return &Conversation{
+		Id:       s.Id,
+		Window:   s.Window,
+		Messages: branch.Messages,
+		Recap:    branch.Recap,
+		Pending:  branch.Pending,
+	}
+}
+
+// branchesSize returns how many bytes the branches that are put away take when stored
+func (s *Conversation) branchesSize() int {
+	size := 0
+	for _, branch := range s.Branches {
+		if branch.ID != s.Branch {
+			size += s.stashed(branch).size()
+		}
+	}
+	return size
+}
+
+// limitBranches holds the branches that are put away to the same limits as the active one: at most window
+// messages and maxBytes each, 0 disables the byte limit. It returns how many bytes the branches take.
+func (s *Conversation) limitBranches(window int, maxBytes int) int {
+	size := 0
+	for i, branch := range s.Branches {
+		if branch.ID == s.Branch {
+			continue
+		}
+
+		stashed := s.stashed(branch)
+		stashed.Window = window
+		stashed.Prune()
+		branchSize := stashed.size()
+		if maxBytes > 0 && branchSize > maxBytes {
+			branchSize = stashed.limitSize(maxBytes)
+		}
+		s.Branches[i].Messages = stashed.Messages
+		size += branchSize
+	}
+	return size
+}
+
+// SwitchBranch makes another branch the active one
+func (s *Conversation) SwitchBranch(id string) error {
+	i, ok := s.findBranch(id)
+	if !ok {
+		return ErrUnknownBranch
+	}
+	if id == s.Branch {
+		return nil
+	}
+
+	s.stash()
+	s.Messages = s.Branches[i].Messages
+	s.Recap = s.Branches[i].Recap
+	s.Pending = s.Branches[i].Pending
+	s.Branches[i].Messages = nil
+	s.Branches[i].Recap = ""
+	s.Branches[i].Pending = nil
+	s.Branch = id
+	s.Updated = time.Now()
+	return nil
+}
+
+// ListBranches describes the branches of the conversation, oldest first
+func (s *Conversation) ListBranches() []BranchSummary {
+	summaries := make([]BranchSummary, 0, len(s.Branches))
+	for _, branch := range s.Branches {
+		messages := branch.Messages
+		if branch.ID == s.Branch {
+			messages = s.Messages
+		}
+
+		summary := BranchSummary{
+			ID:      branch.ID,
+			Parent:  branch.Parent,
+			Fork:    branch.Fork,
+			Created: branch.Created,
+			Active:  branch.ID == s.Branch,
+		}
+		for _, message := range messages {
+			if message.Role == "system" {
+				continue
+			}
+			summary.Messages++
+			if message.Role == "user" && !message.IsToolResponse() {
+				summary.Preview = strings.TrimSpace(message.GetContent())
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// EditMessage branches the conversation at a user message and runs the turn again with the new prompt.
+// Resources and other attachments of the original message are kept. If the turn fails there is no new branch.
+func (h *Host) EditMessage(ctx context.Context, conversation *Conversation, id string, prompt string) error {
+	index, ok := conversation.findMessage(id)
+	if !ok {
+		return ErrUnknownMessage
+	}
+	original := conversation.Messages[index]
+	if original.Role != "user" || original.IsToolResponse() {
+		return ErrWrongRole
+	}
+
+	content := []history.ContentBlock{{Type: "text", Text: prompt}}
+	for _, block := range original.Content {
+		if block.Type != "text" {
+			content = append(content, block)
+		}
+	}
+
+	return h.branchAndRun(ctx, conversation, index, &history.HistoryMessage{Role: "user", Content: content})
+}
+
+// RegenerateMessage branches the conversation at a reply of the llm and runs the turn that led to it again,
+// from the user message before it. If the turn fails there is no new branch.
+func (h *Host) RegenerateMessage(ctx context.Context, conversation *Conversation, id string) error {
+	index, ok := conversation.findMessage(id)
+	if !ok {
+		return ErrUnknownMessage
+	}
+	if conversation.Messages[index].Role != "assistant" {
+		return ErrWrongRole
+	}
+
+	// the turn starts after the user's message, tool calls and their results before the reply are redone too
+	start := index
+	for start > 0 && (conversation.Messages[start-1].Role != "user" || conversation.Messages[start-1].IsToolResponse()) {
+		start--
+	}
+	if start == 0 {
+		return ErrWrongRole
+	}
+
+	return h.branchAndRun(ctx, conversation, start, nil)
+}
@@ -0,0 +1,155 @@
+package mcphost
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ConversationLimits bound the memory conversations take, zero values disable a limit
+type ConversationLimits struct {
+	// IdleTimeout evicts conversations that were not used for this long
+	IdleTimeout time.Duration
+
+	// MaxConversations caps how many conversations are kept in memory, the least recently used go first
+	MaxConversations int
+
+	// MaxBytes caps the size of a single conversation, see Conversation.limitSize
+	MaxBytes int
+}
+
+// ConversationStats reports the conversations held in memory and what the janitor did about them.
+// Evicted conversations are offloaded when the store is persistent and dropped otherwise.
+type ConversationStats struct {
+	InMemory   int   `json:"inMemory"`
+	Bytes      int   `json:"bytes"`
+	Persistent bool  `json:"persistent"`
+	Expired    int64 `json:"expired"`
+	Evicted    int64 `json:"evicted"`
+	Trimmed    int64 `json:"trimmed"`
+}
+
+type cachedConversation struct {
+	conversation *Conversation
+	used         time.Time
+	size         int
+}
+
+// cached returns a conversation held in memory and marks it as used
+func (s *ConversationManager) cached(id string) (*Conversation, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.cache[id]
+	if !ok {
+		return nil, false
+	}
+	entry.used = time.Now()
+	return entry.conversation, true
+}
+
+// remember keeps a loaded conversation in memory, if another request loaded it in the meantime that one is returned
+func (s *ConversationManager) remember(conversation *Conversation, size int) *Conversation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if entry, ok := s.cache[conversation.Id]; ok {
+		entry.used = time.Now()
+		return entry.conversation
+	}
+	s.cache[conversation.Id] = &cachedConversation{conversation: conversation, used: time.Now(), size: size}
+	return conversation
+}
+
+// persistent returns true if evicted conversations stay in the store
+func (s *ConversationManager) persistent() bool {
+	_, memory := s.store.(*MemoryStore)
+	return !memory
+}
+
+// WithLimits sets the limits the janitor and PutConversation enforce
+func (s *ConversationManager) WithLimits(limits ConversationLimits) *ConversationManager {
+	s.limits = limits
+	return s
+}
+
+// Stats returns the conversations held in memory and the evictions so far
+func (s *ConversationManager) Stats() ConversationStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := s.stats
+	stats.InMemory = len(s.cache)
+	stats.Persistent = s.persistent()
+	for _, entry := range s.cache {
+		stats.Bytes += entry.size
+	}
+	return stats
+}
+
+// RunJanitor evicts idle conversations and the least recently used ones over the limit every interval
+// until ctx is done
+func (s *ConversationManager) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.evict(time.Now())
+		}
+	}
+}
+
+// evict removes the conversations that are over the limits from memory
+func (s *ConversationManager) evict(now time.Time) {
+	s.lock.Lock()
+	var expired, evicted []string
+	if s.limits.IdleTimeout > 0 {
+		for id, entry := range s.cache {
+			if now.Sub(entry.used) > s.limits.IdleTimeout {
+				expired = append(expired, id)
+				delete(s.cache, id)
+			}
+		}
+	}
+
+	if s.limits.MaxConversations > 0 && len(s.cache) > s.limits.MaxConversations {
+		ids := make([]string, 0, len(s.cache))
+		for id := range s.cache {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return s.cache[ids[i]].used.Before(s.cache[ids[j]].used)
+		})
+
+		evicted = ids[:len(ids)-s.limits.MaxConversations]
+		for _, id := range evicted {
+			delete(s.cache, id)
+		}
+	}
+
+	s.stats.Expired += int64(len(expired))
+	s.stats.Evicted += int64(len(evicted))
+	persistent := s.persistent()
+	s.lock.Unlock()
+
+	// without a persistent store the memory is the only copy
+	if !persistent {
+		for _, id := range append(expired, evicted...) {
+			s.store.Delete(id)
+		}
+	}
+
+	stats := s.Stats()
+	if len(expired) > 0 || len(evicted) > 0 {
+		log.Info("Conversations evicted", "expired", len(expired), "evicted", len(evicted), "offloaded", persistent,
+			"in memory", stats.InMemory, "bytes", stats.Bytes)
+		return
+	}
+	log.Debug("Conversations checked", "in memory", stats.InMemory, "bytes", stats.Bytes)
+}
@@ -1,20 +1,46 @@
 package mcphost
 
 import (
+	"context"
+	"errors"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
 
 	"github.com/thirdmartini/mcpgw/pkg/history"
 )
 
+// ErrUnknownConversation is returned when updating a conversation that isn't stored
+var ErrUnknownConversation = errors.New("unknown conversation")
+
 type ConversationManager struct {
-	lock         sync.RWMutex
 	systemPrompt string
-	conversation map[string]*Conversation
+	store        ConversationStore
+	limits       ConversationLimits
+	policy       ConcurrencyPolicy
+	summarizer   *Summarizer
+
+	// cache holds the conversations in use, they are written through to the store and evicted by the janitor
+	lock  sync.Mutex
+	cache map[string]*cachedConversation
+	turns map[string]*conversationTurn
+	stats ConversationStats
+
+	// summarizing holds the conversations being summarized in the background
+	summarizing map[string]bool
+
+	// titling holds when the llm started naming a conversation, or last failed to
+	titling map[string]time.Time
 }
 
 func (s *ConversationManager) newConversation(id string) *Conversation {
+	now := time.Now()
 	conversation := &Conversation{
 		Id:       id,
+		Created:  now,
+		Updated:  now,
 		Messages: []history.HistoryMessage{},
 		Window:   16,
 	}
@@ -33,34 +59,186 @@ func (s *ConversationManager) newConversation(id string) *Conversation {
 	return conversation
 }
 
-func (s *ConversationManager) GetConversation(id string) *Conversation {
+// NewConversation starts an anonymous conversation, it is not kept after the request
+func (s *ConversationManager) NewConversation() *Conversation {
+	return s.newConversation("")
+}
+
+// GetConversation claims a conversation for a turn and returns a copy of it to work on, the copy replaces the
+// stored conversation when it is handed back with PutConversation. Only one turn runs per conversation, what happens
+// to overlapping requests depends on the concurrency policy. ctx bounds the wait for the conversation, the
+// returned context is the turn's which is cancelled when a newer request takes over.
+func (s *ConversationManager) GetConversation(ctx context.Context, id string) (*Conversation, context.Context, error) {
 	if id == "" {
-		return s.newConversation("")
+		return s.newConversation(""), ctx, nil
 	}
 
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	if conversation, ok := s.conversation[id]; ok {
-		return conversation
+	turn, turnCtx, err := s.beginTurn(ctx, id, s.policy, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conversation, ok := s.load(id)
+	if !ok {
+		conversation = s.newConversation(id)
+	}
+
+	conversation = conversation.clone()
+	conversation.assignIDs()
+	conversation.turn = turn
+	return conversation, turnCtx, nil
+}
+
+// load returns the committed conversation from the cache or the store, the caller must hold its turn
+func (s *ConversationManager) load(id string) (*Conversation, bool) {
+	if conversation, ok := s.cached(id); ok {
+		return conversation, true
 	}
 
-	return s.newConversation(id)
+	conversation, ok, err := s.store.Load(id)
+	if err != nil {
+		log.Error("Failed to load conversation, starting over", "session", id, "error", err)
+	}
+	if !ok {
+		return nil, false
+	}
+	return s.remember(conversation, conversation.size()+conversation.branchesSize()), true
 }
 
+// UpdateConversation changes a stored conversation without running a turn, for edits such as its title. The update
+// waits for a running turn whatever the concurrency policy and is not cancelled by newer requests. An error from
+// update leaves the conversation as it was. The updated conversation is returned, it must not be changed.
+func (s *ConversationManager) UpdateConversation(ctx context.Context, id string, update func(*Conversation) error) (*Conversation, error) {
+	turn, _, err := s.beginTurn(ctx, id, QueuePolicy, true)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, ok := s.load(id)
+	if !ok {
+		s.endTurn(&Conversation{Id: id, turn: turn})
+		return nil, ErrUnknownConversation
+	}
+
+	conversation = conversation.clone()
+	conversation.turn = turn
+	if err := update(conversation); err != nil {
+		s.endTurn(conversation)
+		return nil, err
+	}
+
+	s.PutConversation(conversation)
+	return conversation, nil
+}
+
+// PutConversation stores the conversation of a turn and lets the next request have it
 func (s *ConversationManager) PutConversation(conversation *Conversation) {
 	if conversation.Id == "" {
 		return
 	}
+	defer s.endTurn(conversation)
 
-	conversation.Prune()
+	if !s.activeTurn(conversation) {
+		log.Warn("Conversation turn was cancelled, dropping its changes", "session", conversation.Id)
+		return
+	}
+
+	// with a summarizer messages beyond the window are summarized instead of pruned, once the turn is over
+	summarize := false
+	if s.summarizer != nil {
+		_, summarize = s.needsSummary(conversation)
+	} else {
+		conversation.Prune()
+	}
+
+	size := conversation.size()
+	if s.limits.MaxBytes > 0 && size > s.limits.MaxBytes {
+		previous := size
+		size = conversation.limitSize(s.limits.MaxBytes)
+		s.lock.Lock()
+		s.stats.Trimmed++
+		s.lock.Unlock()
+		log.Info("Conversation trimmed", "session", conversation.Id, "bytes", previous, "trimmed to", size)
+	}
+
+	// with a summarizer the active branch may run past the window until it is summarized, so may the others
+	window := conversation.Window
+	if s.summarizer != nil {
+		window += s.summarizer.options.Trigger
+	}
+	size += conversation.limitBranches(window, s.limits.MaxBytes)
+
+	if err := s.store.Save(conversation); err != nil {
+		log.Error("Failed to save conversation", "session", conversation.Id, "error", err)
+	}
 	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.conversation[conversation.Id] = conversation
+	s.cache[conversation.Id] = &cachedConversation{conversation: conversation, used: time.Now(), size: size}
+	s.lock.Unlock()
+
+	if summarize {
+		s.summarize(conversation)
+	}
+}
+
+// FindConversation returns a stored conversation, unlike GetConversation it doesn't start a new one or a turn.
+// The conversation is shared with other readers and must not be changed.
+func (s *ConversationManager) FindConversation(id string) (*Conversation, bool, error) {
+	if conversation, ok := s.cached(id); ok {
+		return conversation, true, nil
+	}
+	return s.store.Load(id)
+}
+
+// ListConversations returns a page of the stored conversations, most recently updated first,
+// and the number of conversations there are in total
+func (s *ConversationManager) ListConversations(offset, limit int) ([]ConversationSummary, int, error) {
+	summaries, err := s.store.List()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].Updated.Equal(summaries[j].Updated) {
+			return summaries[i].Updated.After(summaries[j].Updated)
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+
+	total := len(summaries)
+	offset = min(max(offset, 0), total)
+	end := min(offset+limit, total)
+	return summaries[offset:end], total, nil
+}
+
+// DeleteConversation removes a conversation from the store. A running turn is cancelled and its changes are dropped
+// so it doesn't save the conversation again, ctx bounds the wait for it to stop.
+func (s *ConversationManager) DeleteConversation(ctx context.Context, id string) error {
+	turn, _, err := s.beginTurn(ctx, id, CancelPolicy, false)
+	if err != nil {
+		return err
+	}
+	defer s.endTurn(&Conversation{Id: id, turn: turn})
+
+	s.lock.Lock()
+	delete(s.cache, id)
+	s.lock.Unlock()
+	return s.store.Delete(id)
+}
+
+// WithStore sets where conversations are kept, the default store keeps them in memory
+func (s *ConversationManager) WithStore(store ConversationStore) *ConversationManager {
+	s.store = store
+	return s
 }
 
 func NewConversationManager(systemPrompt string) *ConversationManager {
 	return &ConversationManager{
 		systemPrompt: systemPrompt,
-		conversation: make(map[string]*Conversation),
+		store:        NewMemoryStore(),
+		cache:        make(map[string]*cachedConversation),
+		turns:        make(map[string]*conversationTurn),
+		summarizing:  make(map[string]bool),
+		titling:      make(map[string]time.Time),
+		policy:       QueuePolicy,
 	}
 }
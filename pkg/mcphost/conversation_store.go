@@ -0,0 +1,205 @@
+package mcphost
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+// ConversationStore keeps the conversations of a ConversationManager
+type ConversationStore interface {
+	// Load returns the stored conversation with the given id, ok is false if there is none
+	Load(id string) (conversation *Conversation, ok bool, err error)
+
+	// Save stores the conversation under its id, replacing the previous version
+	Save(conversation *Conversation) error
+
+	// Delete removes a conversation, deleting an unknown conversation is not an error
+	Delete(id string) error
+
+	// List describes every stored conversation, in no particular order
+	List() ([]ConversationSummary, error)
+}
+
+// MemoryStore keeps conversations in memory, they are lost when the gateway restarts
+type MemoryStore struct {
+	lock          sync.RWMutex
+	conversations map[string]*Conversation
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		conversations: make(map[string]*Conversation),
+	}
+}
+
+func (s *MemoryStore) Load(id string) (*Conversation, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	conversation, ok := s.conversations[id]
+	return conversation, ok, nil
+}
+
+func (s *MemoryStore) Save(conversation *Conversation) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.conversations[conversation.Id] = conversation
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conversations, id)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]ConversationSummary, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	summaries := make([]ConversationSummary, 0, len(s.conversations))
+	for _, conversation := range s.conversations {
+		summaries = append(summaries, conversation.Summary())
+	}
+	return summaries, nil
+}
+
+// FileStore keeps every conversation in a JSON file of its own, so conversations survive restarts. Next to it
+// a small summary file lets the conversations be listed without reading their messages.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a store that keeps its conversations in dir, the directory is created if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating conversation directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// DefaultConversationDir is where conversations are kept when no directory is configured
+func DefaultConversationDir() string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "mcpgw", "conversations")
+	}
+	return "conversations"
+}
+
+// path returns the file of a conversation, ids come from clients so they are encoded to be safe file names
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(id))+".json")
+}
+
+// summaryPath returns the summary file that goes with the file of a conversation
+func summaryPath(path string) string {
+	return strings.TrimSuffix(path, ".json") + ".summary"
+}
+
+func (s *FileStore) Load(id string) (*Conversation, bool, error) {
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	conversation := &Conversation{}
+	if err := json.Unmarshal(data, conversation); err != nil {
+		return nil, false, fmt.Errorf("reading conversation %s: %w", id, err)
+	}
+	return conversation, true, nil
+}
+
+// Save writes the conversation and then its summary
+func (s *FileStore) Save(conversation *Conversation) error {
+	path := s.path(conversation.Id)
+	if err := writeJSON(path, conversation); err != nil {
+		return err
+	}
+	return writeJSON(summaryPath(path), conversation.Summary())
+}
+
+// writeJSON writes to a temporary file first so a crash never leaves a truncated file behind
+func writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *FileStore) Delete(id string) error {
+	path := s.path(id)
+	for _, file := range []string{path, summaryPath(path)} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List reads the summaries of the conversations of the directory, files that can't be read are skipped
+func (s *FileStore) List() ([]ConversationSummary, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []ConversationSummary{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		summary, err := s.summary(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			log.Warn("Failed to read conversation", "file", entry.Name(), "error", err)
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// summary reads the summary of the conversation stored in path. Conversations stored before there were summary
+// files are read in full once and get one.
+func (s *FileStore) summary(path string) (ConversationSummary, error) {
+	var summary ConversationSummary
+	data, err := os.ReadFile(summaryPath(path))
+	if err == nil {
+		err = json.Unmarshal(data, &summary)
+	}
+	if err == nil {
+		return summary, nil
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return summary, err
+	}
+	conversation := &Conversation{}
+	if err := json.Unmarshal(data, conversation); err != nil {
+		return summary, err
+	}
+
+	summary = conversation.Summary()
+	if err := writeJSON(summaryPath(path), summary); err != nil {
+		log.Warn("Failed to save conversation summary", "file", filepath.Base(path), "error", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,140 @@
+package mcphost
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+)
+
+func TestFileStoreSaveLoad(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	conversation := &Conversation{
+		// ids come from clients, they must still make safe file names
+		Id:      "a/b ../c",
+		Title:   "Shopping",
+		Created: now,
+		Updated: now,
+		Window:  16,
+		Messages: []history.HistoryMessage{
+			{ID: "1", Role: "system", Content: []history.ContentBlock{{Type: "text", Text: "be nice"}}},
+			{ID: "2", Role: "user", Content: []history.ContentBlock{{Type: "text", Text: "what's on my list?"}}},
+			{ID: "3", Role: "tool", Content: []history.ContentBlock{history.NewToolResult("call-1", []mcp.Content{
+				mcp.NewTextContent("milk"),
+				mcp.NewImageContent("aGVsbG8=", "image/png"),
+				mcp.NewAudioContent("aGVsbG8=", "audio/wav"),
+				mcp.NewResourceLink("file:///list", "list", "", "text/plain"),
+				mcp.NewEmbeddedResource(mcp.TextResourceContents{URI: "file:///y", MIMEType: "text/plain", Text: "y"}),
+			})}},
+		},
+		Pending: []PendingToolCall{{
+			ID:        "call-2",
+			Name:      "reminders__delete",
+			Arguments: json.RawMessage(`{"title":"milk"}`),
+			Requested: now,
+		}},
+	}
+
+	if err := store.Save(conversation); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, ok, err := store.Load(conversation.Id)
+	if err != nil || !ok {
+		t.Fatalf("load: ok=%v err=%v", ok, err)
+	}
+	if !reflect.DeepEqual(loaded, conversation) {
+		t.Errorf("load returned a different conversation\n got: %#v\nwant: %#v", loaded, conversation)
+	}
+
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0] != conversation.Summary() {
+		t.Errorf("list returned %v, want %v", summaries, conversation.Summary())
+	}
+
+	if err := store.Delete(conversation.Id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok, err := store.Load(conversation.Id); ok || err != nil {
+		t.Errorf("load after delete: ok=%v err=%v", ok, err)
+	}
+	if err := store.Delete(conversation.Id); err != nil {
+		t.Errorf("deleting an unknown conversation: %v", err)
+	}
+}
+
+func TestFileStoreLoadUnknown(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+
+	if _, ok, err := store.Load("nope"); ok || err != nil {
+		t.Errorf("load: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestFileStoreListReadsSummaries(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("creating store: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	listed := &Conversation{Id: "listed", Title: "Listed", Created: now, Updated: now, Window: 16, Messages: []history.HistoryMessage{
+		{ID: "1", Role: "user", Content: []history.ContentBlock{{Type: "text", Text: "hello", Images: []string{"aGVsbG8="}}}},
+	}}
+	if err := store.Save(listed); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// listing must not read the messages, a conversation file it can't parse is still listed from its summary
+	if err := os.WriteFile(store.path(listed.Id), []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// conversations stored before there were summaries are read once and get one
+	older := &Conversation{Id: "older", Title: "Older", Created: now, Updated: now, Window: 16}
+	data, _ := json.Marshal(older)
+	if err := os.WriteFile(store.path(older.Id), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	want := []ConversationSummary{
+		{ID: "listed", Title: "Listed", Created: now, Updated: now, Messages: 1},
+		older.Summary(),
+	}
+	if !reflect.DeepEqual(summaries, want) {
+		t.Errorf("list returned %v, want %v", summaries, want)
+	}
+	if _, err := os.Stat(summaryPath(store.path(older.Id))); err != nil {
+		t.Errorf("the older conversation got no summary: %v", err)
+	}
+
+	if err := store.Delete(listed.Id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := os.Stat(summaryPath(store.path(listed.Id))); !os.IsNotExist(err) {
+		t.Errorf("the summary outlived its conversation: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+)
+
+func appendExchange(conversation *Conversation, text string, image string) {
+	user := history.ContentBlock{Type: "text", Text: text}
+	if image != "" {
+		user.Images = []string{image}
+	}
+	conversation.Append(history.HistoryMessage{Role: "user", Content: []history.ContentBlock{user}})
+	conversation.Append(history.HistoryMessage{Role: "assistant", Content: []history.ContentBlock{{Type: "text", Text: "ok " + text}}})
+}
+
+func TestStashedBranchesAreLimitedOnTheirOwn(t *testing.T) {
+	const maxBytes = 4000
+	manager := NewConversationManager("be nice").WithLimits(ConversationLimits{MaxBytes: maxBytes})
+	ctx := context.Background()
+
+	// a large original history with images, then a branch off its first message
+	conversation, _, err := manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		appendExchange(conversation, fmt.Sprintf("question %d", i), strings.Repeat("A", 1000))
+	}
+	conversation.fork(1)
+	appendExchange(conversation, "edited", "")
+	manager.PutConversation(conversation)
+
+	conversation, _, err = manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.PutConversation(conversation)
+
+	// the active branch is small and must not be trimmed because of the stashed one
+	if got := len(conversation.Messages); got != 3 {
+		t.Errorf("active branch has %d messages, want 3", got)
+	}
+
+	if len(conversation.Branches) != 2 {
+		t.Fatalf("got %d branches, want 2", len(conversation.Branches))
+	}
+	for _, branch := range conversation.Branches {
+		if branch.ID == conversation.Branch {
+			continue
+		}
+		stashed := conversation.stashed(branch)
+		if len(stashed.Messages) > conversation.Window {
+			t.Errorf("stashed branch has %d messages, more than the window of %d", len(stashed.Messages), conversation.Window)
+		}
+		if size := stashed.size(); size > maxBytes {
+			t.Errorf("stashed branch takes %d bytes, more than %d", size, maxBytes)
+		}
+	}
+}
+
+func TestCloneCopiesBranches(t *testing.T) {
+	conversation := &Conversation{Id: "c", Window: 16}
+	appendExchange(conversation, "hello", "aGVsbG8=")
+	conversation.fork(0)
+
+	cloned := conversation.clone()
+	cloned.Branches[0].Messages[0].Content[0].DropMedia()
+
+	if len(conversation.Branches[0].Messages[0].Content[0].Images) == 0 {
+		t.Error("trimming the clone changed the original branch")
+	}
+}
+
+func TestUpdateConversationWaitsForTheTurn(t *testing.T) {
+	manager := NewConversationManager("be nice").WithConcurrencyPolicy(CancelPolicy)
+	ctx := context.Background()
+
+	conversation, _, err := manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.PutConversation(conversation)
+
+	// a turn is running while the conversation is renamed
+	conversation, _, err = manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := make(chan error)
+	go func() {
+		_, err := manager.UpdateConversation(ctx, "c", func(conversation *Conversation) error {
+			conversation.Title = "renamed"
+			return nil
+		})
+		renamed <- err
+	}()
+
+	appendExchange(conversation, "hello", "")
+	manager.PutConversation(conversation)
+	if err := <-renamed; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	stored, _, _ := manager.FindConversation("c")
+	if stored.Title != "renamed" {
+		t.Errorf("title is %q, want renamed", stored.Title)
+	}
+	if len(stored.Messages) != 3 {
+		t.Errorf("the turn's messages were dropped, %d messages are stored", len(stored.Messages))
+	}
+
+	if _, err := manager.UpdateConversation(ctx, "unknown", func(*Conversation) error { return nil }); err != ErrUnknownConversation {
+		t.Errorf("updating an unknown conversation: %v", err)
+	}
+	if _, ok, _ := manager.FindConversation("unknown"); ok {
+		t.Error("updating an unknown conversation created it")
+	}
+}
+
+func TestDeleteConversationDropsTheTurn(t *testing.T) {
+	manager := NewConversationManager("be nice")
+	ctx := context.Background()
+
+	conversation, _, err := manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.PutConversation(conversation)
+
+	conversation, turnCtx, err := manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := make(chan error)
+	go func() {
+		deleted <- manager.DeleteConversation(ctx, "c")
+	}()
+
+	// the turn finishes once it sees it was cancelled, its changes must not save the conversation again
+	<-turnCtx.Done()
+	appendExchange(conversation, "hello", "")
+	manager.PutConversation(conversation)
+	if err := <-deleted; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, ok, _ := manager.FindConversation("c"); ok {
+		t.Error("the cancelled turn saved the deleted conversation")
+	}
+}
+
+func TestFailedEditLeavesNoBranch(t *testing.T) {
+	provider := &replyProvider{reply: "sure"}
+	host := &Host{provider: provider}
+	conversation := &Conversation{Id: "c", Window: 16}
+	appendExchange(conversation, "hello", "")
+	question := conversation.Messages[0].ID
+
+	provider.err = errors.New("the llm is down")
+	if err := host.EditMessage(context.Background(), conversation, question, "hi"); err == nil {
+		t.Fatal("the edit didn't fail")
+	}
+	if conversation.Branch != "" || len(conversation.Branches) != 0 {
+		t.Errorf("the failed edit left branch %q of %d", conversation.Branch, len(conversation.Branches))
+	}
+	if len(conversation.Messages) != 2 || conversation.Messages[0].GetContent() != "hello" {
+		t.Errorf("the failed edit changed the history: %+v", conversation.Messages)
+	}
+
+	provider.err = nil
+	if err := host.EditMessage(context.Background(), conversation, question, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if len(conversation.Branches) != 2 || conversation.Messages[0].GetContent() != "hi" {
+		t.Errorf("the edit didn't branch: %d branches, first message %q", len(conversation.Branches), conversation.Messages[0].GetContent())
+	}
+}
+
+func TestLastResponse(t *testing.T) {
+	question := history.HistoryMessage{Role: "user", Content: []history.ContentBlock{{Type: "text", Text: "draw and delete"}}}
+	calls := history.HistoryMessage{Role: "assistant", Content: []history.ContentBlock{
+		{Type: "text", Text: "drawing, then deleting once you approve"},
+		{Type: "tool_use", ID: "call-1", Name: "paint__draw"},
+		{Type: "tool_use", ID: "call-2", Name: "files__delete"},
+	}}
+	drawn := history.HistoryMessage{Role: "user", Content: []history.ContentBlock{
+		history.NewToolResult("call-1", []mcp.Content{mcp.NewImageContent("aGVsbG8=", "image/png")}),
+	}}
+	reply := history.HistoryMessage{Role: "assistant", Content: []history.ContentBlock{{Type: "text", Text: "here it is"}}}
+
+	tests := []struct {
+		name     string
+		messages []history.HistoryMessage
+		pending  []PendingToolCall
+		want     string
+		images   int
+	}{
+		{"reply", []history.HistoryMessage{question, reply}, nil, "here it is", 0},
+		{"reply after tool results", []history.HistoryMessage{question, calls, drawn, reply}, nil, "here it is", 1},
+		{"calls waiting for approval after ones that ran", []history.HistoryMessage{question, calls, drawn},
+			[]PendingToolCall{{ID: "call-2", Name: "files__delete"}}, "drawing, then deleting once you approve", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conversation := &Conversation{Messages: test.messages, Pending: test.pending}
+			response := conversation.LastResponse()
+			if response.Message != test.want {
+				t.Errorf("message is %q, want %q", response.Message, test.want)
+			}
+			if len(response.Images) != test.images {
+				t.Errorf("%d images, want %d", len(response.Images), test.images)
+			}
+			if len(response.Pending) != len(test.pending) {
+				t.Errorf("%d pending calls, want %d", len(response.Pending), len(test.pending))
+			}
+		})
+	}
+}
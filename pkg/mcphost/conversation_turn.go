@@ -0,0 +1,114 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+)
+
+// ErrConversationBusy is returned when a conversation is already running a turn and the policy is to reject
+var ErrConversationBusy = errors.New("conversation is busy with another request")
+
+// ConcurrencyPolicy decides what happens to a request for a conversation that is already running a turn
+type ConcurrencyPolicy string
+
+const (
+	// QueuePolicy waits for the running turn to finish
+	QueuePolicy ConcurrencyPolicy = "queue"
+	// RejectPolicy fails the request with ErrConversationBusy
+	RejectPolicy ConcurrencyPolicy = "reject"
+	// CancelPolicy cancels the running turn, its changes are discarded
+	CancelPolicy ConcurrencyPolicy = "cancel"
+)
+
+// ParseConcurrencyPolicy checks a configured policy, an empty policy queues
+func ParseConcurrencyPolicy(policy string) (ConcurrencyPolicy, error) {
+	switch ConcurrencyPolicy(policy) {
+	case "":
+		return QueuePolicy, nil
+	case QueuePolicy, RejectPolicy, CancelPolicy:
+		return ConcurrencyPolicy(policy), nil
+	}
+	return "", fmt.Errorf("unknown conversation concurrency policy %q", policy)
+}
+
+// conversationTurn is a request working on a conversation, only one runs per conversation at a time
+type conversationTurn struct {
+	done       chan struct{}
+	cancel     context.CancelFunc
+	superseded bool
+
+	// update is a quick change of the conversation's metadata, newer requests wait for it even when they cancel turns
+	update bool
+}
+
+// WithConcurrencyPolicy sets what happens to requests for a conversation that is running a turn, the default queues them
+func (s *ConversationManager) WithConcurrencyPolicy(policy ConcurrencyPolicy) *ConversationManager {
+	s.policy = policy
+	return s
+}
+
+// beginTurn waits until the conversation is free and claims it, ctx bounds the wait and policy decides what
+// happens to a turn that is running. An update turn only changes metadata and is never cancelled.
+func (s *ConversationManager) beginTurn(ctx context.Context, id string, policy ConcurrencyPolicy, update bool) (*conversationTurn, context.Context, error) {
+	for {
+		s.lock.Lock()
+		current, busy := s.turns[id]
+		if !busy {
+			// the turn outlives the request that started it so the conversation is never left half done
+			turnCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+			turn := &conversationTurn{done: make(chan struct{}), cancel: cancel, update: update}
+			s.turns[id] = turn
+			s.lock.Unlock()
+			return turn, turnCtx, nil
+		}
+
+		switch {
+		case current.update:
+			// metadata updates are over quickly, they are waited for whatever the policy
+		case policy == RejectPolicy:
+			s.lock.Unlock()
+			return nil, nil, ErrConversationBusy
+		case policy == CancelPolicy:
+			if !current.superseded {
+				log.Info("Conversation turn cancelled by a newer request", "session", id)
+			}
+			current.superseded = true
+			current.cancel()
+		}
+		s.lock.Unlock()
+
+		select {
+		case <-current.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// activeTurn returns true if the conversation's turn still holds it, a cancelled turn's changes are dropped
+func (s *ConversationManager) activeTurn(conversation *Conversation) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	turn := conversation.turn
+	return turn != nil && s.turns[conversation.Id] == turn && !turn.superseded
+}
+
+// endTurn releases the conversation to the next request
+func (s *ConversationManager) endTurn(conversation *Conversation) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	turn := conversation.turn
+	if turn == nil || s.turns[conversation.Id] != turn {
+		return
+	}
+	conversation.turn = nil
+
+	delete(s.turns, conversation.Id)
+	turn.cancel()
+	close(turn.done)
+}
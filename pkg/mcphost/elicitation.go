@@ -0,0 +1,239 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var (
+	// ErrNoPendingElicitation is returned when answering an elicitation that is not waiting for the user
+	ErrNoPendingElicitation = errors.New("no pending elicitation")
+
+	// ErrElicitationContent is returned when an accepted answer doesn't fit the schema the server asked for
+	ErrElicitationContent = errors.New("invalid elicitation content")
+
+	// ErrElicitationConversation is returned when answering a question that wasn't sent to the conversation answering it
+	ErrElicitationConversation = errors.New("the elicitation was not sent to this conversation")
+)
+
+// elicitationTimeout bounds how long a tool call waits for the user's answer before the elicitation is cancelled
+const elicitationTimeout = 5 * time.Minute
+
+// Asker puts a question of a server to the user of the client that made the tool call, see WithAsker
+type Asker func(request mcp.ElicitationRequest) (*mcp.ElicitationResult, error)
+
+// declinedElicitation is the answer to questions nobody can be asked
+var declinedElicitation = &mcp.ElicitationResult{
+	ElicitationResponse: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionDecline},
+}
+
+// WithUnattended tells the host that nobody answers its queues, as when it only serves the proxy. Questions and
+// sampling requests that need approval are then declined right away unless the client of the call can be asked.
+func (h *Host) WithUnattended() *Host {
+	h.unattended = true
+	return h
+}
+
+// PendingElicitation is a question a server asked the user in the middle of a tool call
+type PendingElicitation struct {
+	ID           string    `json:"id"`
+	Server       string    `json:"server"`
+	Conversation string    `json:"conversation,omitempty"`
+	Tool         string    `json:"tool,omitempty"`
+	ToolCallID   string    `json:"toolCallId,omitempty"`
+	Message      string    `json:"message"`
+	Schema       any       `json:"requestedSchema"`
+	Requested    time.Time `json:"requested"`
+
+	// Conversations are the conversations the question was sent to, only they may answer it
+	Conversations []string `json:"conversations,omitempty"`
+
+	answer chan mcp.ElicitationResponse
+}
+
+// sentTo returns true if the question was sent to the conversation, questions sent to none are anyone's to answer
+func (p *PendingElicitation) sentTo(conversation string) bool {
+	return len(p.Conversations) == 0 || slices.Contains(p.Conversations, conversation)
+}
+
+// elicitationHandler relays the elicitation requests of one server to the user
+type elicitationHandler struct {
+	host   *Host
+	server string
+}
+
+func (e *elicitationHandler) Elicit(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	return e.host.elicit(ctx, e.server, request)
+}
+
+// elicit publishes the question of a server to the conversations waiting on it and blocks until the user answers
+func (h *Host) elicit(ctx context.Context, server string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	pending := &PendingElicitation{
+		ID:        uuid.New().String(),
+		Server:    server,
+		Message:   request.Params.Message,
+		Schema:    request.Params.RequestedSchema,
+		Requested: time.Now(),
+		answer:    make(chan mcp.ElicitationResponse, 1),
+	}
+
+	// like log messages, an elicitation doesn't say which tool call it belongs to
+	calls := h.events.running(server)
+	if len(calls) == 1 {
+		if calls[0].asker != nil {
+			log.Info("Server asks the client", "server", server, "tool", calls[0].tool, "message", request.Params.Message)
+			return calls[0].asker(request)
+		}
+		pending.Conversation = calls[0].conversation
+		pending.Tool = calls[0].tool
+		pending.ToolCallID = calls[0].toolCallID
+	}
+	for _, call := range calls {
+		if call.conversation != "" && !slices.Contains(pending.Conversations, call.conversation) {
+			pending.Conversations = append(pending.Conversations, call.conversation)
+		}
+	}
+	if h.unattended {
+		log.Warn("Server asks a question nobody can answer, declining", "server", server, "message", request.Params.Message)
+		return declinedElicitation, nil
+	}
+
+	h.elicitationLock.Lock()
+	if h.elicitations == nil {
+		h.elicitations = make(map[string]*PendingElicitation)
+	}
+	h.elicitations[pending.ID] = pending
+	h.elicitationLock.Unlock()
+
+	defer func() {
+		h.elicitationLock.Lock()
+		delete(h.elicitations, pending.ID)
+		h.elicitationLock.Unlock()
+	}()
+
+	log.Info("Server asks the user", "server", server, "id", pending.ID, "message", pending.Message)
+	for _, call := range calls {
+		h.events.publish(Event{
+			Type:         EventElicitation,
+			Conversation: call.conversation,
+			Server:       server,
+			Tool:         call.tool,
+			ToolCallID:   call.toolCallID,
+			Message:      pending.Message,
+			Elicitation:  pending,
+			Time:         pending.Requested,
+		})
+	}
+
+	timer := time.NewTimer(elicitationTimeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-pending.answer:
+		return &mcp.ElicitationResult{ElicitationResponse: answer}, nil
+	case <-timer.C:
+		log.Warn("Elicitation was not answered in time", "server", server, "id", pending.ID)
+		return &mcp.ElicitationResult{
+			ElicitationResponse: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionCancel},
+		}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// PendingElicitations returns the questions of servers waiting for the user's answer, oldest first.
+// With a conversation only the questions sent to it are returned.
+func (h *Host) PendingElicitations(conversation string) []PendingElicitation {
+	h.elicitationLock.Lock()
+	defer h.elicitationLock.Unlock()
+
+	pending := []PendingElicitation{}
+	for _, p := range h.elicitations {
+		if conversation == "" || slices.Contains(p.Conversations, conversation) {
+			pending = append(pending, *p)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Requested.Before(pending[j].Requested)
+	})
+	return pending
+}
+
+// ResolveElicitation answers a question of a server on behalf of a conversation, which must be one the question
+// was sent to. Accepted answers must contain the fields the schema requires, declined and cancelled ones carry
+// no content.
+func (h *Host) ResolveElicitation(conversation string, id string, action mcp.ElicitationResponseAction, content map[string]any) error {
+	h.elicitationLock.Lock()
+	pending, ok := h.elicitations[id]
+	if ok && !pending.sentTo(conversation) {
+		h.elicitationLock.Unlock()
+		log.Warn("Elicitation answered by another conversation", "server", pending.Server, "id", id, "conversation", conversation)
+		return ErrElicitationConversation
+	}
+	if ok && action == mcp.ElicitationResponseActionAccept {
+		if err := checkElicitationContent(pending.Schema, content); err != nil {
+			h.elicitationLock.Unlock()
+			return err
+		}
+	}
+	delete(h.elicitations, id)
+	h.elicitationLock.Unlock()
+
+	if !ok {
+		return ErrNoPendingElicitation
+	}
+
+	response := mcp.ElicitationResponse{Action: action}
+	if action == mcp.ElicitationResponseActionAccept {
+		response.Content = content
+	}
+
+	log.Info("Elicitation answered", "server", pending.Server, "id", id, "action", action)
+	pending.answer <- response
+	return nil
+}
+
+// checkElicitationContent makes sure an answer has the required fields of the schema and only the ones it knows
+func checkElicitationContent(schema any, content map[string]any) error {
+	object, ok := schema.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	properties, _ := object["properties"].(map[string]any)
+	required, _ := object["required"].([]any)
+	for _, name := range required {
+		if _, ok := content[fmt.Sprint(name)]; !ok {
+			return fmt.Errorf("%w: missing %v", ErrElicitationContent, name)
+		}
+	}
+
+	for name, value := range content {
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: unknown field %s", ErrElicitationContent, name)
+		}
+		if values, ok := property["enum"].([]any); ok && !containsValue(values, value) {
+			return fmt.Errorf("%w: %v is not one of the choices for %s", ErrElicitationContent, value, name)
+		}
+	}
+	return nil
+}
+
+func containsValue(values []any, value any) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package mcphost
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// approving answers every question with approve set to the value
+func approving(approve bool, asked *int) Asker {
+	return func(request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+		*asked++
+		return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{
+			Action:  mcp.ElicitationResponseActionAccept,
+			Content: map[string]any{"approve": approve},
+		}}, nil
+	}
+}
+
+func TestElicitAsksTheClientOfTheCall(t *testing.T) {
+	host := (&Host{}).WithUnattended()
+	asked := 0
+	_, done := host.events.track(activeCall{server: "s", tool: "t", asker: approving(true, &asked)})
+	defer done()
+
+	result, err := host.elicit(context.Background(), "s", mcp.ElicitationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asked != 1 || result.Action != mcp.ElicitationResponseActionAccept {
+		t.Errorf("the client was asked %d times, the answer was %s", asked, result.Action)
+	}
+	if pending := host.PendingElicitations(""); len(pending) != 0 {
+		t.Errorf("%d questions were queued", len(pending))
+	}
+}
+
+func TestElicitDeclinesWhenNobodyCanAnswer(t *testing.T) {
+	host := (&Host{}).WithUnattended()
+
+	// two calls are running on the server, it can't tell which client to ask
+	asked := 0
+	_, done := host.events.track(activeCall{server: "s", asker: approving(true, &asked)})
+	defer done()
+	_, done = host.events.track(activeCall{server: "s", asker: approving(true, &asked)})
+	defer done()
+
+	result, err := host.elicit(context.Background(), "s", mcp.ElicitationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asked != 0 || result.Action != mcp.ElicitationResponseActionDecline {
+		t.Errorf("the clients were asked %d times, the answer was %s", asked, result.Action)
+	}
+}
+
+func TestSamplingApproval(t *testing.T) {
+	tests := []struct {
+		name    string
+		asker   func(asked *int) Asker
+		wantErr bool
+	}{
+		{"approved by the client", func(asked *int) Asker { return approving(true, asked) }, false},
+		{"declined by the client", func(asked *int) Asker { return approving(false, asked) }, true},
+		{"nobody to ask", func(*int) Asker { return nil }, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			host := (&Host{}).WithUnattended()
+			asked := 0
+			_, done := host.events.track(activeCall{server: "s", asker: test.asker(&asked)})
+			defer done()
+
+			err := host.awaitSamplingApproval(context.Background(), "s", mcp.CreateMessageRequest{}, 100)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got %v, want an error: %v", err, test.wantErr)
+			}
+			if pending := host.PendingSamplings(); len(pending) != 0 {
+				t.Errorf("%d sampling requests were queued", len(pending))
+			}
+		})
+	}
+}
+
+func TestElicitationIsAnsweredByItsConversations(t *testing.T) {
+	host := &Host{}
+	_, done := host.events.track(activeCall{server: "s", conversation: "a"})
+	defer done()
+	_, done = host.events.track(activeCall{server: "s", conversation: "b"})
+	defer done()
+
+	answered := make(chan *mcp.ElicitationResult)
+	go func() {
+		result, _ := host.elicit(context.Background(), "s", mcp.ElicitationRequest{})
+		answered <- result
+	}()
+
+	var pending []PendingElicitation
+	waitFor(t, "the question", func() bool {
+		pending = host.PendingElicitations("a")
+		return len(pending) == 1
+	})
+	if len(host.PendingElicitations("c")) != 0 {
+		t.Error("the question is listed for a conversation it wasn't sent to")
+	}
+
+	id := pending[0].ID
+	if err := host.ResolveElicitation("c", id, mcp.ElicitationResponseActionDecline, nil); err != ErrElicitationConversation {
+		t.Errorf("answering from another conversation: %v", err)
+	}
+	if err := host.ResolveElicitation("b", id, mcp.ElicitationResponseActionDecline, nil); err != nil {
+		t.Fatalf("answering from a conversation it was sent to: %v", err)
+	}
+	if result := <-answered; result.Action != mcp.ElicitationResponseActionDecline {
+		t.Errorf("the server got %s", result.Action)
+	}
+}
@@ -0,0 +1,260 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// mcp-go has no constants for the notifications servers send about a request
+	methodNotificationProgress = "notifications/progress"
+	methodNotificationMessage  = "notifications/message"
+
+	// EventProgress reports the progress of a running tool call
+	EventProgress = "progress"
+	// EventLog is a log message of a server
+	EventLog = "log"
+	// EventElicitation is a question of a server the user has to answer before the tool call continues
+	EventElicitation = "elicitation"
+
+	// eventBuffer is how many events a slow subscriber may fall behind before events are dropped
+	eventBuffer = 64
+)
+
+// Event is a notification of an MCP server relayed to the clients following a conversation
+type Event struct {
+	Type         string  `json:"type"`
+	Conversation string  `json:"conversation"`
+	Server       string  `json:"server"`
+	Tool         string  `json:"tool,omitempty"`
+	ToolCallID   string  `json:"toolCallId,omitempty"`
+	Progress     float64 `json:"progress,omitempty"`
+	Total        float64 `json:"total,omitempty"`
+	Level        string  `json:"level,omitempty"`
+	Logger       string  `json:"logger,omitempty"`
+	Message      string  `json:"message,omitempty"`
+	Data         any     `json:"data,omitempty"`
+
+	Elicitation *PendingElicitation `json:"elicitation,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// activeCall is a tool call that is running on a server, progress notifications find it by its token
+type activeCall struct {
+	conversation string
+	server       string
+	tool         string
+	toolCallID   string
+
+	// asker puts the questions of the server to the client that made the call, if it can be asked
+	asker Asker
+}
+
+// eventBroker fans the events of a conversation out to its subscribers
+type eventBroker struct {
+	lock        sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+	calls       map[string]activeCall
+}
+
+func (b *eventBroker) subscribe(conversation string) (chan Event, func()) {
+	events := make(chan Event, eventBuffer)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[string]map[chan Event]struct{})
+	}
+	if b.subscribers[conversation] == nil {
+		b.subscribers[conversation] = make(map[chan Event]struct{})
+	}
+	b.subscribers[conversation][events] = struct{}{}
+
+	return events, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		delete(b.subscribers[conversation], events)
+		if len(b.subscribers[conversation]) == 0 {
+			delete(b.subscribers, conversation)
+		}
+	}
+}
+
+// publish hands the event to every subscriber of its conversation without waiting for slow ones
+func (b *eventBroker) publish(event Event) {
+	if event.Conversation == "" {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for events := range b.subscribers[event.Conversation] {
+		select {
+		case events <- event:
+		default:
+			log.Debug("Dropped event for slow subscriber", "conversation", event.Conversation, "type", event.Type)
+		}
+	}
+}
+
+// track registers a running tool call and returns the progress token sent with it
+func (b *eventBroker) track(call activeCall) (string, func()) {
+	token := uuid.New().String()
+
+	b.lock.Lock()
+	if b.calls == nil {
+		b.calls = make(map[string]activeCall)
+	}
+	b.calls[token] = call
+	b.lock.Unlock()
+
+	return token, func() {
+		b.lock.Lock()
+		delete(b.calls, token)
+		b.lock.Unlock()
+	}
+}
+
+func (b *eventBroker) call(token string) (activeCall, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	call, ok := b.calls[token]
+	return call, ok
+}
+
+// running returns the tool calls currently running on a server
+func (b *eventBroker) running(server string) []activeCall {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var calls []activeCall
+	for _, call := range b.calls {
+		if call.server == server {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+type conversationKey struct{}
+
+// withConversation tags the context of a turn with its conversation, tool calls made in it report their events there
+func withConversation(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, conversationKey{}, id)
+}
+
+func conversationFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(conversationKey{}).(string)
+	return id
+}
+
+type askerKey struct{}
+
+// WithAsker tags the context of a tool call with the client that made it, the questions and sampling approvals of
+// the server during the call are put to that client instead of being queued for the gateway's api
+func WithAsker(ctx context.Context, asker Asker) context.Context {
+	return context.WithValue(ctx, askerKey{}, asker)
+}
+
+func askerFromContext(ctx context.Context) Asker {
+	asker, _ := ctx.Value(askerKey{}).(Asker)
+	return asker
+}
+
+// Subscribe returns the events of a conversation until the returned function is called
+func (h *Host) Subscribe(conversation string) (<-chan Event, func()) {
+	return h.events.subscribe(conversation)
+}
+
+// setLogLevel asks a server that supports logging to send its info messages, servers default to errors only
+func setLogLevel(name string, client mcpclient.MCPClient) {
+	if capabilities, ok := serverCapabilities(client); !ok || capabilities.Logging == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req := mcp.SetLevelRequest{}
+	req.Params.Level = mcp.LoggingLevelInfo
+	if err := client.SetLevel(ctx, req); err != nil {
+		log.Warn("Failed to set log level", "name", name, "error", err)
+	}
+}
+
+// relayNotification logs the progress and log notifications of a server and forwards them to the
+// conversations whose tool calls they belong to
+func (h *Host) relayNotification(server string, notification mcp.JSONRPCNotification) {
+	params := notification.Params.AdditionalFields
+
+	switch notification.Method {
+	case methodNotificationProgress:
+		call, ok := h.events.call(fmt.Sprint(params["progressToken"]))
+		if !ok {
+			return
+		}
+
+		event := Event{
+			Type:         EventProgress,
+			Conversation: call.conversation,
+			Server:       server,
+			Tool:         call.tool,
+			ToolCallID:   call.toolCallID,
+			Time:         time.Now(),
+		}
+		event.Progress, _ = params["progress"].(float64)
+		event.Total, _ = params["total"].(float64)
+		event.Message, _ = params["message"].(string)
+
+		log.Info("Tool progress", "server", server, "tool", call.tool, "progress", event.Progress, "total", event.Total, "message", event.Message)
+		h.events.publish(event)
+
+	case methodNotificationMessage:
+		level, _ := params["level"].(string)
+		logger, _ := params["logger"].(string)
+		data := params["data"]
+
+		logServerMessage(server, level, logger, data)
+
+		// a log message doesn't say which request it belongs to, it goes to every conversation waiting on the server
+		message, _ := data.(string)
+		for _, call := range h.events.running(server) {
+			h.events.publish(Event{
+				Type:         EventLog,
+				Conversation: call.conversation,
+				Server:       server,
+				Tool:         call.tool,
+				ToolCallID:   call.toolCallID,
+				Level:        level,
+				Logger:       logger,
+				Message:      message,
+				Data:         data,
+				Time:         time.Now(),
+			})
+		}
+	}
+}
+
+// logServerMessage writes a log message of a server to the gateway's log at a matching level
+func logServerMessage(server, level, logger string, data any) {
+	keyvals := []interface{}{"server", server, "logger", logger, "data", data}
+
+	switch mcp.LoggingLevel(level) {
+	case mcp.LoggingLevelDebug:
+		log.Debug("Server log", keyvals...)
+	case mcp.LoggingLevelInfo, mcp.LoggingLevelNotice:
+		log.Info("Server log", keyvals...)
+	case mcp.LoggingLevelWarning:
+		log.Warn("Server log", keyvals...)
+	default:
+		log.Error("Server log", keyvals...)
+	}
+}
@@ -0,0 +1,56 @@
+package mcphost
+
+import (
+	"path"
+
+	"github.com/charmbracelet/log"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// matchesAny returns true if name matches one of the glob patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			log.Warn("Invalid tool pattern", "pattern", pattern, "error", err)
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsTool returns true if the server's include/exclude lists expose the tool to the llm.
+// An empty include list allows every tool, exclude always wins over include.
+func (o *ServerOptions) AllowsTool(name string) bool {
+	if len(o.Include) > 0 && !matchesAny(name, o.Include) {
+		return false
+	}
+	return !matchesAny(name, o.Exclude)
+}
+
+// filterTools drops the tools the server options do not expose and applies description overrides
+func (o *ServerOptions) filterTools(serverName string, tools []mcp.Tool) []mcp.Tool {
+	var filtered []mcp.Tool
+	for _, tool := range tools {
+		if !o.AllowsTool(tool.Name) {
+			log.Debug("Tool filtered", "server", serverName, "tool", tool.Name)
+			continue
+		}
+		if description, ok := o.Descriptions[tool.Name]; ok {
+			tool.Description = description
+		}
+		filtered = append(filtered, tool)
+	}
+	return filtered
+}
+
+func (h *Host) allowsTool(serverName, toolName string) bool {
+	options, ok := h.serverOptions(serverName)
+	if !ok {
+		return true
+	}
+	return options.AllowsTool(toolName)
+}
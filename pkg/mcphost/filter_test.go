@@ -0,0 +1,63 @@
+package mcphost
+
+import (
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestAllowsTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ServerOptions
+		tool    string
+		want    bool
+	}{
+		{"no lists", ServerOptions{}, "delete_file", true},
+		{"included", ServerOptions{Include: []string{"read_*"}}, "read_file", true},
+		{"not included", ServerOptions{Include: []string{"read_*"}}, "delete_file", false},
+		{"excluded", ServerOptions{Exclude: []string{"delete_*"}}, "delete_file", false},
+		{"not excluded", ServerOptions{Exclude: []string{"delete_*"}}, "read_file", true},
+		{"exclude wins over include", ServerOptions{Include: []string{"*_file"}, Exclude: []string{"delete_*"}}, "delete_file", false},
+		{"exact names", ServerOptions{Include: []string{"read_file"}}, "read_files", false},
+		{"any of several patterns", ServerOptions{Include: []string{"list_*", "read_?ile"}}, "read_file", true},
+		{"character classes", ServerOptions{Exclude: []string{"[dr]*"}}, "read_file", false},
+		{"invalid pattern matches nothing", ServerOptions{Include: []string{"[", "read_*"}}, "read_file", true},
+		{"invalid exclude doesn't block", ServerOptions{Exclude: []string{"["}}, "read_file", true},
+		{"only an invalid include blocks", ServerOptions{Include: []string{"["}}, "read_file", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.options.AllowsTool(test.tool); got != test.want {
+				t.Errorf("AllowsTool(%q) = %v, want %v", test.tool, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterTools(t *testing.T) {
+	options := ServerOptions{
+		Exclude:      []string{"delete_*"},
+		Descriptions: map[string]string{"read_file": "Reads one of the user's notes"},
+	}
+	tools := []mcp.Tool{
+		mcp.NewTool("read_file", mcp.WithDescription("Reads a file")),
+		mcp.NewTool("delete_file", mcp.WithDescription("Deletes a file")),
+		mcp.NewTool("list_files", mcp.WithDescription("Lists files")),
+	}
+
+	filtered := options.filterTools("notes", tools)
+	if len(filtered) != 2 || filtered[0].Name != "read_file" || filtered[1].Name != "list_files" {
+		t.Fatalf("got %v", filtered)
+	}
+	if filtered[0].Description != "Reads one of the user's notes" {
+		t.Errorf("description is %q, the override wasn't applied", filtered[0].Description)
+	}
+	if filtered[1].Description != "Lists files" {
+		t.Errorf("description is %q, want the server's", filtered[1].Description)
+	}
+	if tools[0].Description != "Reads a file" {
+		t.Error("filtering changed the server's tools")
+	}
+}
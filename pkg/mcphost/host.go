@@ -3,12 +3,15 @@ package mcphost
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 
 	"github.com/thirdmartini/mcpgw/pkg/history"
@@ -18,45 +21,143 @@ import (
 type Host struct {
 	systemPrompt string
 	provider     llm.Provider
-	clients      map[string]mcpclient.MCPClient
-	tools        []llm.Tool
+	servers      *supervisor
+	oauth        *oauthManager
+
+	// reload and rebuild serialize config reloads and tool list rebuilds,
+	// lock guards the config and the published names and tools
+	reload  sync.Mutex
+	rebuild sync.Mutex
+	lock    sync.RWMutex
+	config  *MCPConfig
+	names   *toolNamespace
+	tools   []llm.Tool
+
+	// sampling holds the sampling requests of servers waiting for the user's approval
+	samplingLock sync.Mutex
+	sampling     map[string]*PendingSampling
+
+	// elicitations holds the questions of servers waiting for the user's answer
+	elicitationLock sync.Mutex
+	elicitations    map[string]*PendingElicitation
+
+	// unattended hosts have nobody answering their queues, see WithUnattended
+	unattended bool
+
+	// listeners are told when the tools, resources or prompts of the servers change
+	listeners []func()
+
+	// events relays the progress and log notifications of running tool calls to their conversations
+	events eventBroker
 }
 
 type ChatResponse struct {
-	Message string      `json:"message"`
-	Images  []string    `json:"images"`
-	Metrics llm.Metrics `json:"metrics"`
+	Message   string             `json:"message"`
+	Images    []string           `json:"images"`
+	Audio     []string           `json:"audio,omitempty"`
+	Resources []history.Resource `json:"resources,omitempty"`
+	Pending   []PendingToolCall  `json:"pending,omitempty"`
+	Metrics   llm.Metrics        `json:"metrics"`
 }
 
 func (h *Host) Close() {
-	for name, client := range h.clients {
-		if err := client.Close(); err != nil {
-			log.Error("Failed to close server", "name", name, "error", err)
-		} else {
-			log.Info("Server closed", "name", name)
-		}
+	if h.servers != nil {
+		h.servers.close()
+	}
+}
+
+// serverConfig returns the configuration of a server
+func (h *Host) serverConfig(name string) (ServerConfigWrapper, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if h.config == nil {
+		return ServerConfigWrapper{}, false
 	}
+	server, ok := h.config.MCPServers[name]
+	return server, ok
+}
+
+// serverOptions returns the gateway options of a configured server
+func (h *Host) serverOptions(name string) (ServerOptions, bool) {
+	server, ok := h.serverConfig(name)
+	return server.Options, ok
+}
+
+// toolset returns the tools currently offered to the llm and the names used to dispatch them
+func (h *Host) toolset() ([]llm.Tool, *toolNamespace) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.tools, h.names
 }
 
 type ToolDescription struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	RequiresApproval bool   `json:"requiresApproval,omitempty"`
 }
 
 func (h *Host) ListTools() []ToolDescription {
 	descriptions := []ToolDescription{}
 
-	for _, tool := range h.tools {
+	tools, names := h.toolset()
+	for _, tool := range tools {
+		ref, _ := names.resolve(tool.Name)
 		descriptions = append(descriptions, ToolDescription{
-			Name:        tool.Name,
-			Description: tool.Description,
+			Name:             tool.Name,
+			Description:      tool.Description,
+			RequiresApproval: h.requiresApproval(ref.Server, ref.Tool),
 		})
 	}
 	return descriptions
 }
 
+// Model returns the name of the model the host runs prompts with
+func (h *Host) Model() string {
+	return llm.ModelName(h.provider)
+}
+
+// conversationTools returns the tools offered to the llm in a conversation, the caller's tools take
+// the place of gateway tools with the same name
+func (h *Host) conversationTools(conversation *Conversation) []llm.Tool {
+	tools, _ := h.toolset()
+	if len(conversation.ClientTools) == 0 {
+		return tools
+	}
+
+	offered := make([]llm.Tool, 0, len(tools)+len(conversation.ClientTools))
+	for _, tool := range tools {
+		if !conversation.isClientTool(tool.Name) {
+			offered = append(offered, tool)
+		}
+	}
+	return append(offered, conversation.ClientTools...)
+}
+
 func (h *Host) RunPrompt(ctx context.Context, prompt string, conversation *Conversation) error {
-	return h.runPromptNonInteractive(ctx, prompt, conversation)
+	return h.RunPromptWithResources(ctx, prompt, nil, conversation)
+}
+
+// RunPromptWithResources runs a prompt with the content of the given resources attached to it.
+// A prompt that starts with a slash command (/server.prompt arg=value) is replaced by the messages of that MCP prompt.
+func (h *Host) RunPromptWithResources(ctx context.Context, prompt string, uris []string, conversation *Conversation) error {
+	attachments, err := h.ResourceBlocks(ctx, uris)
+	if err != nil {
+		return err
+	}
+
+	messages, ok, err := h.ExpandCommand(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	if ok {
+		h.declinePending(conversation)
+		for _, message := range messages {
+			conversation.Append(message)
+		}
+		prompt = ""
+	}
+
+	return h.runPromptNonInteractive(ctx, prompt, conversation, attachments...)
 }
 
 /*
@@ -171,19 +272,129 @@ func (h *Host) runToolCalls(ctx context.Context, conversation *Conversation, mes
 	})
 } */
 
-func (h *Host) runPromptNonInteractive(ctx context.Context, prompt string, conversation *Conversation) error {
+// resolveTool maps the tool name used by the llm back to the server and tool it stands for
+func (h *Host) resolveTool(name string) (string, string, bool) {
+	_, names := h.toolset()
+	if names == nil {
+		return "", "", false
+	}
+	ref, ok := names.resolve(name)
+	return ref.Server, ref.Tool, ok
+}
+
+// callTool dispatches a namespaced tool call to its server and converts the result into a tool_result block.
+// Every call produces a result, failures are reported back to the llm as error results so it can correct itself.
+func (h *Host) callTool(ctx context.Context, id string, name string, input json.RawMessage) history.ContentBlock {
+	serverName, toolName, ok := h.resolveTool(name)
+	if !ok {
+		log.Warnf("Error: Unknown tool: %s\n", name)
+		return history.NewToolError(id, h.unknownToolMessage(name))
+	}
+
+	if serverName == builtinServer {
+		return h.callBuiltinTool(ctx, id, toolName, input)
+	}
+
+	mcpClient, ok := h.servers.client(serverName)
+	if !ok {
+		log.Warnf("Error: Server not available: %s\n", serverName)
+		return history.NewToolError(id, fmt.Sprintf("Error: the server providing tool %s is not available right now", name))
+	}
+
+	// the llm can make up names of tools it was never offered, never dispatch those
+	if !h.allowsTool(serverName, toolName) {
+		log.Warn("Rejected call to filtered tool", "tool_name", toolName, "server", serverName)
+		return history.NewToolError(id, fmt.Sprintf("Error: tool %s is not available", name))
+	}
+
+	var toolArgs map[string]interface{}
+	if err := json.Unmarshal(input, &toolArgs); err != nil {
+		log.Warnf("Error parsing tool arguments: %v\n", err)
+		return history.NewToolError(id, fmt.Sprintf("Error: the arguments for tool %s are not a valid JSON object: %v", name, err))
+	}
+
+	log.Info("LLM Requests Tool Call", "tool_name", toolName, "tool_args", toolArgs, "server", serverName)
+
+	toolResult, err := h.dispatchTool(ctx, id, mcpClient, serverName, toolName, toolArgs)
+	if err != nil {
+		errMsg := fmt.Sprintf(
+			"Error calling tool %s: %v",
+			toolName,
+			err,
+		)
+
+		// Add an error message as tool result
+		return history.NewToolError(id, errMsg)
+	}
+
+	if len(toolResult.Content) == 0 {
+		toolResult.Content = []mcp.Content{mcp.NewTextContent("The tool returned no content.")}
+	}
+
+	result := history.NewToolResult(id, toolResult.Content)
+	result.IsError = toolResult.IsError
+	return result
+}
+
+// dispatchTool calls a tool of a running server, recording the call and relaying its progress to the conversation of ctx
+func (h *Host) dispatchTool(ctx context.Context, id string, mcpClient mcpclient.MCPClient, serverName, toolName string, toolArgs map[string]interface{}) (*mcp.CallToolResult, error) {
+	// the progress token lets the server's progress notifications find their way back to the conversation
+	token, done := h.events.track(activeCall{
+		conversation: conversationFromContext(ctx),
+		server:       serverName,
+		tool:         toolName,
+		toolCallID:   id,
+		asker:        askerFromContext(ctx),
+	})
+	defer done()
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = toolName
+	req.Params.Arguments = toolArgs
+	req.Params.Meta = &mcp.Meta{ProgressToken: token}
+	startTime := time.Now()
+	toolResult, err := mcpClient.CallTool(
+		ctx,
+		req,
+	)
+	h.servers.recordCall(serverName, time.Since(startTime), err != nil || toolResult.IsError)
+
+	if err != nil {
+		log.Error("Tool call error", "tool_name", toolName, "tool_args", toolArgs, "server", serverName, "error", err)
+
+		// the connection may be gone, have the supervisor check it now rather than at the next ping
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) {
+			h.servers.check(serverName)
+		}
+		return nil, err
+	}
+
+	log.Info("Tool call success", "tool_name", toolName, "tool_args", toolArgs, "server", serverName, "result", toolResultToString(toolResult))
+	return toolResult, nil
+}
+
+func (h *Host) runPromptNonInteractive(ctx context.Context, prompt string, conversation *Conversation, attachments ...history.ContentBlock) error {
 	var message llm.Message
 	var err error
 
+	ctx = withConversation(ctx, conversation.Id)
+
 	// This appends the prompt to the history for next time
-	if prompt != "" {
+	if prompt != "" || len(attachments) > 0 {
 		log.Infof("Prompt: %s\n", prompt)
-		conversation.Append(history.HistoryMessage{
-			Role: "user",
-			Content: []history.ContentBlock{{
+		h.declinePending(conversation)
+
+		var content []history.ContentBlock
+		if prompt != "" {
+			content = append(content, history.ContentBlock{
 				Type: "text",
 				Text: prompt,
-			}},
+			})
+		}
+		conversation.Append(history.HistoryMessage{
+			Role:    "user",
+			Content: append(content, attachments...),
 		})
 	}
 
@@ -199,7 +410,7 @@ func (h *Host) runPromptNonInteractive(ctx context.Context, prompt string, conve
 		ctx,
 		prompt,
 		llmMessages,
-		h.tools,
+		h.conversationTools(conversation),
 	)
 
 	if err != nil {
@@ -235,7 +446,9 @@ func (h *Host) runPromptNonInteractive(ctx context.Context, prompt string, conve
 		})
 	}
 
-	for _, toolCall := range message.GetToolCalls() {
+	// resolve the tool calls once, ids are synthesized where the provider has none so uses and results pair up
+	toolCalls := withToolCallIDs(message.GetToolCalls())
+	for _, toolCall := range toolCalls {
 		input, _ := json.Marshal(toolCall.GetArguments())
 		messageContent = append(messageContent, history.ContentBlock{
 			Type:  "tool_use",
@@ -251,91 +464,36 @@ func (h *Host) runPromptNonInteractive(ctx context.Context, prompt string, conve
 	})
 
 	// handle toolcalls requested by llm
-	//toolResults := h.runToolCalls(ctx, message)
-
-	for _, toolCall := range message.GetToolCalls() {
+	clientCalls := 0
+	for _, toolCall := range toolCalls {
 		input, _ := json.Marshal(toolCall.GetArguments())
 
-		parts := strings.Split(toolCall.GetName(), "__")
-		if len(parts) != 2 {
-			log.Warnf("Error: Invalid tool name format: %s\n", toolCall.GetName())
+		if conversation.isClientTool(toolCall.GetName()) {
+			clientCalls++
 			continue
 		}
 
-		serverName, toolName := parts[0], parts[1]
-		mcpClient, ok := h.clients[serverName]
-		if !ok {
-			log.Warnf("Error: Server not found: %s\n", serverName)
-			continue
-		}
-
-		var toolArgs map[string]interface{}
-		if err := json.Unmarshal(input, &toolArgs); err != nil {
-			log.Warnf("Error parsing tool arguments: %v\n", err)
+		if err := llm.ToolCallArgumentsError(toolCall); err != nil {
+			log.Warn("Malformed tool call arguments", "tool", toolCall.GetName(), "error", err)
+			toolResults = append(toolResults, history.NewToolError(toolCall.GetID(),
+				fmt.Sprintf("Error: the arguments for tool %s could not be parsed: %v", toolCall.GetName(), err)))
 			continue
 		}
 
-		log.Info("LLM Requests Tool Call", "tool_name", toolName, "tool_args", toolArgs, "server", serverName)
-
-		req := mcp.CallToolRequest{}
-		req.Params.Name = toolName
-		req.Params.Arguments = toolArgs
-		toolResult, err := mcpClient.CallTool(
-			context.Background(),
-			req,
-		)
-
-		if err != nil {
-			log.Error("Tool call error", "tool_name", toolName, "tool_args", toolArgs, "server", serverName, "error", err)
-			errMsg := fmt.Sprintf(
-				"Error calling tool %s: %v",
-				toolName,
-				err,
-			)
-
-			// Add an error message as tool result
-			toolResults = append(toolResults, history.ContentBlock{
-				Type:      "tool_result",
-				ToolUseID: toolCall.GetID(),
-				Text:      errMsg,
-				Content: []mcp.Content{
-					mcp.TextContent{
-						Type: "text",
-						Text: errMsg,
-					},
-				},
+		if serverName, toolName, ok := h.resolveTool(toolCall.GetName()); ok && h.requiresApproval(serverName, toolName) {
+			log.Info("Tool call requires approval", "tool_name", toolName, "server", serverName, "id", toolCall.GetID())
+			conversation.Pending = append(conversation.Pending, PendingToolCall{
+				ID:        toolCall.GetID(),
+				Name:      toolCall.GetName(),
+				Server:    serverName,
+				Tool:      toolName,
+				Arguments: input,
+				Requested: time.Now(),
 			})
 			continue
 		}
 
-		log.Info("Tool call success", "tool_name", toolName, "tool_args", toolArgs, "server", serverName, "result", toolResultToString(toolResult))
-		if toolResult.Content != nil {
-			//log.Debug("raw tool result content", "content", toolResult.Content)
-
-			// Extract text content
-			var resultText string
-			var resultImages []string
-			// Handle array content directly since we know it's []interface{}
-			for _, item := range toolResult.Content {
-				switch v := item.(type) {
-				case mcp.TextContent:
-					resultText += fmt.Sprintf("%v ", v.Text)
-
-				case mcp.ImageContent:
-					resultImages = append(resultImages, v.Data)
-
-				default:
-					panic(fmt.Sprintf("Unknown content type: %T", item))
-				}
-			}
-			toolResults = append(toolResults, history.ContentBlock{
-				Type:      "tool_result",
-				ToolUseID: toolCall.GetID(),
-				Text:      strings.TrimSpace(resultText),
-				Content:   toolResult.Content,
-				Images:    resultImages,
-			})
-		}
+		toolResults = append(toolResults, h.callTool(ctx, toolCall.GetID(), toolCall.GetName(), input))
 	}
 
 	for _, toolResult := range toolResults {
@@ -346,6 +504,18 @@ func (h *Host) runPromptNonInteractive(ctx context.Context, prompt string, conve
 		})
 	}
 
+	// the turn resumes once the user has approved or denied the pending calls
+	if len(conversation.Pending) > 0 {
+		log.Info("Waiting for tool call approval", "session", conversation.Id, "count", len(conversation.Pending))
+		return nil
+	}
+
+	// the caller answers the calls to its own tools with its next request
+	if clientCalls > 0 {
+		log.Info("Waiting for client tool calls", "session", conversation.Id, "count", clientCalls)
+		return nil
+	}
+
 	log.Infof("Calling LLM to interpret tool results")
 	return h.runPromptNonInteractive(ctx, "", conversation)
 }
@@ -537,47 +707,112 @@ func (h *Host) runPromptNonInteractiveOrig(ctx context.Context, prompt string, c
 	return &response, nil
 }*/
 
+// WithConfig starts the configured MCP servers under supervision. Servers come up independently,
+// the ones that fail to start keep retrying in the background and join the tool list once they are up.
 func (h *Host) WithConfig(mcpConfig *MCPConfig) error {
-	var err error
-
-	h.clients, err = createMCPClients(mcpConfig)
-	if err != nil {
-		return fmt.Errorf("error creating MCP clients: %v", err)
+	if mcpConfig == nil {
+		return fmt.Errorf("no MCP server configuration")
 	}
 
-	for name := range h.clients {
-		log.Info("Server connected", "name", name)
-	}
+	h.lock.Lock()
+	h.config = mcpConfig
+	h.lock.Unlock()
 
-	var allTools []llm.Tool
-	for serverName, mcpClient := range h.clients {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		toolsResult, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
-		cancel()
+	h.servers = newSupervisor(h.oauth, h.clientOptions, h.rebuildTools, h.relayNotification)
+	h.servers.start(mcpConfig)
+	h.rebuildTools()
 
-		if err != nil {
-			log.Error(
-				"Error fetching tools",
-				"server",
-				serverName,
-				"error",
-				err,
-			)
+	tools, _ := h.toolset()
+	log.Info("MCP servers started", "configured", len(mcpConfig.MCPServers), "tools", len(tools))
+	return nil
+}
+
+// rebuildTools recomputes the tools offered to the llm from the servers that are currently running
+func (h *Host) rebuildTools() {
+	h.rebuild.Lock()
+	defer h.rebuild.Unlock()
+
+	// visit servers in a stable order so colliding tool names get the same aliases on every rebuild
+	names := newToolNamespace()
+	allTools := h.builtinTools(names)
+	for _, serverName := range h.servers.names() {
+		serverTools, ok := h.servers.tools(serverName)
+		if !ok {
 			continue
 		}
 
-		serverTools := mcpToolsToAnthropicTools(serverName, toolsResult.Tools)
-		allTools = append(allTools, serverTools...)
+		options, _ := h.serverOptions(serverName)
+		exposed := options.filterTools(serverName, serverTools)
+
+		allTools = append(allTools, mcpToolsToAnthropicTools(names, serverName, options.Aliases, exposed)...)
 		log.Info(
 			"Tools loaded",
 			"server",
 			serverName,
 			"count",
-			len(toolsResult.Tools),
+			len(exposed),
+			"filtered",
+			len(serverTools)-len(exposed),
 		)
 	}
 
+	h.lock.Lock()
+	h.names = names
 	h.tools = allTools
+	h.lock.Unlock()
+
+	h.notifyChanged()
+}
+
+// Reload applies a new server configuration without restarting the gateway. New servers are started,
+// removed ones stopped and servers whose transport settings changed are restarted. Changes to the
+// gateway options of a server (filters, aliases, approvals) only rebuild the tool list.
+func (h *Host) Reload(mcpConfig *MCPConfig) error {
+	if mcpConfig == nil {
+		return fmt.Errorf("no MCP server configuration")
+	}
+	if h.servers == nil {
+		return h.WithConfig(mcpConfig)
+	}
+
+	h.reload.Lock()
+	defer h.reload.Unlock()
+
+	h.lock.Lock()
+	previous := h.config
+	h.config = mcpConfig
+	h.lock.Unlock()
+
+	for name := range previous.MCPServers {
+		if _, ok := mcpConfig.MCPServers[name]; !ok {
+			log.Info("Server removed from config", "name", name)
+			h.servers.remove(name)
+		}
+	}
+
+	for name, server := range mcpConfig.MCPServers {
+		old, ok := previous.MCPServers[name]
+		switch {
+		case !ok:
+			log.Info("Server added to config", "name", name)
+			h.servers.add(name, server, nil)
+
+		case !reflect.DeepEqual(old.Config, server.Config):
+			log.Info("Server config changed, restarting", "name", name)
+			h.servers.replace(name, server)
+
+		case (old.Options.Sampling == nil) != (server.Options.Sampling == nil),
+			(len(old.Options.Roots) == 0) != (len(server.Options.Roots) == 0):
+			// sampling and roots are announced to the server when it connects
+			log.Info("Server capabilities changed, restarting", "name", name)
+			h.servers.replace(name, server)
+
+		case rootsUpdated(old.Options, server.Options):
+			h.servers.rootsChanged(name)
+		}
+	}
+
+	h.rebuildTools()
 	return nil
 }
 
@@ -593,5 +828,6 @@ func (h *Host) WithConfigFile(configSrc string) error {
 func NewHost(provider llm.Provider) *Host {
 	return &Host{
 		provider: provider,
+		oauth:    newOAuthManager(),
 	}
 }
@@ -1,6 +1,7 @@
 package mcphost
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,14 +14,16 @@ import (
 	"github.com/charmbracelet/log"
 
 	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 
 	"github.com/thirdmartini/mcpgw/pkg/llm"
 )
 
 const (
-	transportStdio = "stdio"
-	transportSSE   = "sse"
+	transportStdio          = "stdio"
+	transportSSE            = "sse"
+	transportStreamableHTTP = "http"
 )
 
 var (
@@ -63,6 +66,9 @@ var (
 
 type MCPConfig struct {
 	MCPServers map[string]ServerConfigWrapper `json:"mcpServers"`
+
+	// ResourceTool offers the llm a read_resource tool to read the resources of the servers on demand
+	ResourceTool bool `json:"resourceTool,omitempty"`
 }
 
 type ServerConfig interface {
@@ -80,56 +86,129 @@ func (s STDIOServerConfig) GetType() string {
 }
 
 type SSEServerConfig struct {
-	Url     string   `json:"url"`
-	Headers []string `json:"headers,omitempty"`
+	Url     string       `json:"url"`
+	Headers []string     `json:"headers,omitempty"`
+	OAuth   *OAuthConfig `json:"oauth,omitempty"`
 }
 
 func (s SSEServerConfig) GetType() string {
 	return transportSSE
 }
 
+// StreamableHTTPServerConfig is a remote server speaking the MCP Streamable HTTP transport
+type StreamableHTTPServerConfig struct {
+	Url     string       `json:"url"`
+	Headers []string     `json:"headers,omitempty"`
+	OAuth   *OAuthConfig `json:"oauth,omitempty"`
+}
+
+func (s StreamableHTTPServerConfig) GetType() string {
+	return transportStreamableHTTP
+}
+
+// ServerOptions holds the gateway side settings of a server that apply regardless of its transport
+type ServerOptions struct {
+	RequireApproval *ApprovalPolicy `json:"requireApproval,omitempty"`
+
+	// Include and Exclude are glob patterns (path.Match syntax) selecting which tools are exposed
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Descriptions overrides the description the server reports for a tool
+	Descriptions map[string]string `json:"descriptions,omitempty"`
+
+	// Aliases gives tools a friendly name to present to the llm instead of server__tool
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// Sampling lets the server request completions from the gateway's llm
+	Sampling *SamplingPolicy `json:"sampling,omitempty"`
+
+	// Roots are the directories or URIs the server is told it may work in
+	Roots []RootConfig `json:"roots,omitempty"`
+}
+
 type ServerConfigWrapper struct {
-	Config ServerConfig
+	Config  ServerConfig
+	Options ServerOptions
 }
 
 func (w *ServerConfigWrapper) UnmarshalJSON(data []byte) error {
 	var typeField struct {
-		Url string `json:"url"`
+		Type string `json:"type"`
+		Url  string `json:"url"`
 	}
 
 	if err := json.Unmarshal(data, &typeField); err != nil {
 		return err
 	}
-	if typeField.Url != "" {
-		// If the URL field is present, treat it as an SSE server
+	if err := json.Unmarshal(data, &w.Options); err != nil {
+		return err
+	}
+
+	serverType := typeField.Type
+	if serverType == "" {
+		// without a type a server with a url is an SSE server and anything else a stdio server
+		serverType = transportStdio
+		if typeField.Url != "" {
+			serverType = transportSSE
+		}
+	}
+
+	switch serverType {
+	case transportStdio:
+		var stdio STDIOServerConfig
+		if err := json.Unmarshal(data, &stdio); err != nil {
+			return err
+		}
+		w.Config = stdio
+
+	case transportSSE:
 		var sse SSEServerConfig
 		if err := json.Unmarshal(data, &sse); err != nil {
 			return err
 		}
 		w.Config = sse
-	} else {
-		// Otherwise, treat it as a STDIOServerConfig
-		var stdio STDIOServerConfig
-		if err := json.Unmarshal(data, &stdio); err != nil {
+
+	case transportStreamableHTTP, "streamable-http", "streamableHttp":
+		var streamable StreamableHTTPServerConfig
+		if err := json.Unmarshal(data, &streamable); err != nil {
 			return err
 		}
-		w.Config = stdio
+		w.Config = streamable
+
+	default:
+		return fmt.Errorf("unknown server type %q, expected stdio, sse or http", typeField.Type)
 	}
 
 	return nil
 }
+
 func (w ServerConfigWrapper) MarshalJSON() ([]byte, error) {
-	return json.Marshal(w.Config)
+	// flatten the transport config and the server options into a single object
+	fields := make(map[string]json.RawMessage)
+	fields["type"], _ = json.Marshal(w.Config.GetType())
+	for _, part := range []interface{}{w.Config, w.Options} {
+		data, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
 }
 
 func mcpToolsToAnthropicTools(
+	names *toolNamespace,
 	serverName string,
+	aliases map[string]string,
 	mcpTools []mcp.Tool,
 ) []llm.Tool {
 	anthropicTools := make([]llm.Tool, len(mcpTools))
 
 	for i, tool := range mcpTools {
-		namespacedName := fmt.Sprintf("%s__%s", serverName, tool.Name)
+		namespacedName := names.add(serverName, tool.Name, aliases[tool.Name])
 
 		anthropicTools[i] = llm.Tool{
 			Name:        namespacedName,
@@ -196,97 +275,137 @@ func loadMCPConfig(configFile string) (*MCPConfig, error) {
 	return &config, nil
 }
 
-func createMCPClients(
-	config *MCPConfig,
-) (map[string]mcpclient.MCPClient, error) {
-	clients := make(map[string]mcpclient.MCPClient)
-
-	for name, server := range config.MCPServers {
-		var client mcpclient.MCPClient
-		var err error
-
-		if server.Config.GetType() == transportSSE {
-			sseConfig := server.Config.(SSEServerConfig)
-
-			options := []mcpclient.ClientOption{}
-
-			if sseConfig.Headers != nil {
-				// Parse headers from the config
-				headers := make(map[string]string)
-				for _, header := range sseConfig.Headers {
-					parts := strings.SplitN(header, ":", 2)
-					if len(parts) == 2 {
-						key := strings.TrimSpace(parts[0])
-						value := strings.TrimSpace(parts[1])
-						headers[key] = value
-					}
-				}
-				options = append(options, mcpclient.WithHeaders(headers))
-			}
+// newTransport creates the transport of a single MCP server, it is started by the client
+func newTransport(name string, server ServerConfigWrapper, oauth *oauthManager) (transport.Interface, error) {
+	switch config := server.Config.(type) {
+	case SSEServerConfig:
+		options := []transport.ClientOption{}
+		if config.Headers != nil {
+			options = append(options, mcpclient.WithHeaders(parseHeaders(config.Headers)))
+		}
 
-			client, err = mcpclient.NewSSEMCPClient(
-				sseConfig.Url,
-				options...,
-			)
-			if err == nil {
-				err = client.(*mcpclient.SSEMCPClient).Start(context.Background())
-			}
-		} else {
-			stdioConfig := server.Config.(STDIOServerConfig)
-			var env []string
-			for k, v := range stdioConfig.Env {
-				env = append(env, fmt.Sprintf("%s=%s", k, v))
+		if config.OAuth != nil {
+			oauthConfig, err := oauth.transportConfig(name, config.Url, config.OAuth)
+			if err != nil {
+				return nil, err
 			}
-			client, err = mcpclient.NewStdioMCPClient(
-				stdioConfig.Command,
-				env,
-				stdioConfig.Args...)
+			options = append(options, transport.WithOAuth(oauthConfig))
 		}
-		if err != nil {
-			for _, c := range clients {
-				c.Close()
-			}
-			return nil, fmt.Errorf(
-				"failed to create MCP client for %s: %w",
-				name,
-				err,
-			)
+		return transport.NewSSE(config.Url, options...)
+
+	case StreamableHTTPServerConfig:
+		// listen continuously so the server can send notifications between requests
+		options := []transport.StreamableHTTPCOption{
+			transport.WithContinuousListening(),
+		}
+		if config.Headers != nil {
+			options = append(options, transport.WithHTTPHeaders(parseHeaders(config.Headers)))
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+		if config.OAuth != nil {
+			oauthConfig, err := oauth.transportConfig(name, config.Url, config.OAuth)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, transport.WithHTTPOAuth(oauthConfig))
+		}
+		return transport.NewStreamableHTTP(config.Url, options...)
 
-		log.Info("Initializing server...", "name", name)
-		initRequest := mcp.InitializeRequest{}
-		initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-		initRequest.Params.ClientInfo = mcp.Implementation{
-			Name:    "mcphost",
-			Version: "0.1.0",
+	case STDIOServerConfig:
+		var env []string
+		for k, v := range config.Env {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
 		}
-		initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+		return transport.NewStdio(config.Command, env, config.Args...), nil
 
-		_, err = client.Initialize(ctx, initRequest)
-		if err != nil {
-			client.Close()
-			for _, c := range clients {
-				c.Close()
-			}
-			return nil, fmt.Errorf(
-				"failed to initialize MCP client for %s: %w",
-				name,
-				err,
-			)
+	default:
+		return nil, fmt.Errorf("unsupported server type %T", server.Config)
+	}
+}
+
+// connectMCPServer starts a single MCP server (or connects to it) and runs the initialize handshake.
+// The client options install the handlers for requests the server sends to the gateway (sampling, ...).
+func connectMCPServer(
+	name string,
+	server ServerConfigWrapper,
+	oauth *oauthManager,
+	options ...mcpclient.ClientOption,
+) (mcpclient.MCPClient, error) {
+	trans, err := newTransport(name, server, oauth)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to create MCP client for %s: %w",
+			name,
+			err,
+		)
+	}
+
+	client := mcpclient.NewClient(trans, options...)
+	if err := client.Start(context.Background()); err != nil {
+		client.Close()
+		return nil, fmt.Errorf(
+			"failed to create MCP client for %s: %w",
+			name,
+			err,
+		)
+	}
+	drainStderr(name, client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	log.Info("Initializing server...", "name", name)
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "mcphost",
+		Version: "0.1.0",
+	}
+	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+
+	_, err = client.Initialize(ctx, initRequest)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf(
+			"failed to initialize MCP client for %s: %w",
+			name,
+			err,
+		)
+	}
+
+	return client, nil
+}
+
+// parseHeaders converts "Key: Value" header entries from the config into a map
+func parseHeaders(entries []string) map[string]string {
+	headers := make(map[string]string)
+	for _, header := range entries {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) == 2 {
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
+			headers[key] = value
 		}
+	}
+	return headers
+}
 
-		clients[name] = client
+// drainStderr forwards the stderr of a stdio server to the log, an unread pipe would eventually block the server
+func drainStderr(name string, client *mcpclient.Client) {
+	stderr, ok := mcpclient.GetStderr(client)
+	if !ok || stderr == nil {
+		return
 	}
 
-	return clients, nil
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Debug("Server stderr", "name", name, "line", scanner.Text())
+		}
+	}()
 }
 
 func toolResultToString(toolResult *mcp.CallToolResult) string {
-	toolResult.Content = append(toolResult.Content, mcp.TextContent{})
-
 	content := ""
 	for _, mcpContent := range toolResult.Content {
 		switch v := mcpContent.(type) {
@@ -294,6 +413,12 @@ func toolResultToString(toolResult *mcp.CallToolResult) string {
 			content += "[ Text:" + v.Text + " ]"
 		case mcp.ImageContent:
 			content += "[(Image Data)]"
+		case mcp.AudioContent:
+			content += "[(Audio Data)]"
+		case mcp.ResourceLink:
+			content += "[ Link:" + v.URI + " ]"
+		case mcp.EmbeddedResource:
+			content += "[(Embedded Resource)]"
 		}
 	}
 	return content
@@ -0,0 +1,114 @@
+package mcphost
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// maxToolNameLength is the longest function name OpenAI and Gemini accept
+const maxToolNameLength = 64
+
+var unsafeToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ToolRef identifies a tool on one of the MCP servers
+type ToolRef struct {
+	Server string `json:"server"`
+	Tool   string `json:"tool"`
+}
+
+// toolNamespace hands out provider safe, unique aliases for server tools and keeps the
+// reverse lookup used to dispatch the llm's tool calls.
+type toolNamespace struct {
+	lock    sync.RWMutex
+	byAlias map[string]ToolRef
+	byRef   map[ToolRef]string
+}
+
+func newToolNamespace() *toolNamespace {
+	return &toolNamespace{
+		byAlias: make(map[string]ToolRef),
+		byRef:   make(map[ToolRef]string),
+	}
+}
+
+func sanitizeToolName(name string) string {
+	return unsafeToolNameChars.ReplaceAllString(name, "_")
+}
+
+func shortHash(parts ...string) string {
+	h := sha1.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// withSuffix truncates name so that name_suffix fits the provider limit
+func withSuffix(name string, suffix string) string {
+	if limit := maxToolNameLength - len(suffix) - 1; len(name) > limit {
+		name = name[:limit]
+	}
+	return name + "_" + suffix
+}
+
+// add registers a server tool and returns its alias. The friendly alias from the config is used
+// when it is valid and free, otherwise the alias is derived from the server and tool names.
+func (n *toolNamespace) add(server, tool, friendly string) string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	ref := ToolRef{Server: server, Tool: tool}
+	if alias, ok := n.byRef[ref]; ok {
+		return alias
+	}
+
+	var alias string
+	if friendly != "" && sanitizeToolName(friendly) == friendly && len(friendly) <= maxToolNameLength && !n.taken(friendly) {
+		alias = friendly
+	} else {
+		alias = n.generate(ref)
+	}
+
+	n.byAlias[alias] = ref
+	n.byRef[ref] = alias
+	return alias
+}
+
+func (n *toolNamespace) taken(alias string) bool {
+	_, ok := n.byAlias[alias]
+	return ok
+}
+
+func (n *toolNamespace) generate(ref ToolRef) string {
+	base := fmt.Sprintf("%s__%s", sanitizeToolName(ref.Server), sanitizeToolName(ref.Tool))
+	if len(base) <= maxToolNameLength && !n.taken(base) && base == ref.Server+"__"+ref.Tool {
+		return base
+	}
+
+	// the name was altered, taken or does not fit, make it unique with a hash of the original names
+	alias := withSuffix(base, shortHash(ref.Server, ref.Tool))
+	for i := 1; n.taken(alias); i++ {
+		alias = withSuffix(base, shortHash(ref.Server, ref.Tool, fmt.Sprint(i)))
+	}
+	return alias
+}
+
+// resolve returns the server tool behind an alias
+func (n *toolNamespace) resolve(alias string) (ToolRef, bool) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	ref, ok := n.byAlias[alias]
+	return ref, ok
+}
+
+// alias returns the alias of a server tool
+func (n *toolNamespace) alias(server, tool string) (string, bool) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	alias, ok := n.byRef[ToolRef{Server: server, Tool: tool}]
+	return alias, ok
+}
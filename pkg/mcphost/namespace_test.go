@@ -0,0 +1,89 @@
+package mcphost
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToolAliases(t *testing.T) {
+	long := strings.Repeat("t", 70)
+
+	tests := []struct {
+		name     string
+		server   string
+		tool     string
+		friendly string
+		want     string
+	}{
+		{"plain names", "files", "read", "", "files__read"},
+		{"friendly alias", "files", "read", "read_file", "read_file"},
+		{"unsafe characters", "my server", "do.it", "", "my_server__do_it_" + shortHash("my server", "do.it")},
+		{"unsafe friendly alias", "files", "read", "read file", "files__read"},
+		{"too long", "files", long, "", "files__" + long[:64-len("files__")-9] + "_" + shortHash("files", long)},
+		{"too long friendly alias", "files", "read", long, "files__read"},
+		{"longest friendly alias", "files", "read", long[:64], long[:64]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			namespace := newToolNamespace()
+			alias := namespace.add(test.server, test.tool, test.friendly)
+			if alias != test.want {
+				t.Errorf("alias is %q, want %q", alias, test.want)
+			}
+			if len(alias) > maxToolNameLength {
+				t.Errorf("alias is %d characters long", len(alias))
+			}
+			if ref, ok := namespace.resolve(alias); !ok || ref != (ToolRef{Server: test.server, Tool: test.tool}) {
+				t.Errorf("%q resolves to %+v", alias, ref)
+			}
+			if got, ok := namespace.alias(test.server, test.tool); !ok || got != alias {
+				t.Errorf("the tool's alias is %q", got)
+			}
+		})
+	}
+}
+
+func TestToolAliasCollisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools [][3]string // server, tool, friendly
+	}{
+		{"same joined name", [][3]string{{"a", "b__c", ""}, {"a__b", "c", ""}}},
+		{"same sanitized name", [][3]string{{"my server", "x", ""}, {"my.server", "x", ""}, {"my_server", "x", ""}}},
+		{"same friendly alias", [][3]string{{"files", "read", "read"}, {"notes", "read", "read"}}},
+		{"friendly alias takes a generated one", [][3]string{{"notes", "read", "files__read"}, {"files", "read", ""}}},
+		{"same truncated name", [][3]string{{"files", strings.Repeat("t", 70) + "a", ""}, {"files", strings.Repeat("t", 70) + "b", ""}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			namespace := newToolNamespace()
+			seen := make(map[string]bool)
+			for _, tool := range test.tools {
+				alias := namespace.add(tool[0], tool[1], tool[2])
+				if seen[alias] {
+					t.Errorf("%s/%s got the alias %q of another tool", tool[0], tool[1], alias)
+				}
+				seen[alias] = true
+				if len(alias) > maxToolNameLength {
+					t.Errorf("alias %q is %d characters long", alias, len(alias))
+				}
+				if ref, _ := namespace.resolve(alias); ref != (ToolRef{Server: tool[0], Tool: tool[1]}) {
+					t.Errorf("%q resolves to %+v", alias, ref)
+				}
+			}
+		})
+	}
+}
+
+func TestToolAliasIsKept(t *testing.T) {
+	namespace := newToolNamespace()
+	alias := namespace.add("files", "read", "read_file")
+	if again := namespace.add("files", "read", "other"); again != alias {
+		t.Errorf("adding the tool again changed its alias from %q to %q", alias, again)
+	}
+	if _, ok := namespace.resolve("other"); ok {
+		t.Error("adding the tool again registered a second alias")
+	}
+}
@@ -0,0 +1,451 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantClientCredentials = "client_credentials"
+
+	// authorizationTimeout is how long the user has to finish the browser step of an authorization
+	authorizationTimeout = 10 * time.Minute
+
+	// tokenExpiryMargin renews client credentials tokens a little before they expire
+	tokenExpiryMargin = 30 * time.Second
+
+	oauthClientName = "mcpGW"
+)
+
+var (
+	// ErrNoOAuth is returned when authorizing a server that is not configured for the authorization code flow
+	ErrNoOAuth = errors.New("server is not configured for OAuth authorization")
+
+	// ErrNoOAuthCallback is the error of a server that needs the user to sign in while the gateway serves no OAuth callback
+	ErrNoOAuthCallback = errors.New("server requires OAuth authorization but nothing serves the OAuth callback, " +
+		"authorize it with mcpGW serve or mcpGW proxy --listen first")
+
+	// ErrUnknownAuthorization is returned when an authorization callback does not match a pending authorization
+	ErrUnknownAuthorization = errors.New("unknown or expired authorization")
+)
+
+// OAuthConfig enables the MCP authorization flow for a remote server. Without a client id the gateway
+// registers itself with the authorization server (dynamic client registration).
+type OAuthConfig struct {
+	// Grant is authorization_code (the default, the user signs in through the browser) or client_credentials
+	Grant        string   `json:"grant,omitempty"`
+	ClientID     string   `json:"clientId,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	// MetadataURL skips discovery and points straight at the authorization server metadata
+	MetadataURL string `json:"metadataUrl,omitempty"`
+
+	// RedirectURI overrides the gateway's callback url
+	RedirectURI string `json:"redirectUri,omitempty"`
+
+	// TokenFile overrides where the client registration and tokens of the server are kept
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+func (c *OAuthConfig) grant() string {
+	if c.Grant == "" {
+		return grantAuthorizationCode
+	}
+	return c.Grant
+}
+
+// remoteOAuth returns the url and OAuth settings of a remote server, ok is false if it does not use OAuth
+func remoteOAuth(server ServerConfigWrapper) (string, *OAuthConfig, bool) {
+	switch config := server.Config.(type) {
+	case SSEServerConfig:
+		return config.Url, config.OAuth, config.OAuth != nil
+	case StreamableHTTPServerConfig:
+		return config.Url, config.OAuth, config.OAuth != nil
+	}
+	return "", nil, false
+}
+
+// oauthState is what the gateway persists per server: the registered client and the current token
+type oauthState struct {
+	ClientID     string           `json:"clientId,omitempty"`
+	ClientSecret string           `json:"clientSecret,omitempty"`
+	Token        *transport.Token `json:"token,omitempty"`
+}
+
+// tokenStore keeps the OAuth state of one server in a file so authorizations survive restarts.
+// For the client credentials grant it also fetches a new token whenever the current one expires.
+type tokenStore struct {
+	lock   sync.Mutex
+	path   string
+	state  oauthState
+	config *OAuthConfig
+
+	// handler is used to find the token endpoint for the client credentials grant
+	handler *transport.OAuthHandler
+}
+
+func loadTokenStore(path string, config *OAuthConfig) (*tokenStore, error) {
+	store := &tokenStore{
+		path:   path,
+		config: config,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.state); err != nil {
+		return nil, fmt.Errorf("error parsing token file %s: %w", path, err)
+	}
+	return store, nil
+}
+
+func (s *tokenStore) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("error creating token directory: %w", err)
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// client returns the configured client, falling back to the one registered dynamically
+func (s *tokenStore) client() (string, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.config.ClientID != "" {
+		return s.config.ClientID, s.config.ClientSecret
+	}
+	return s.state.ClientID, s.state.ClientSecret
+}
+
+func (s *tokenStore) saveClient(clientID, clientSecret string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.state.ClientID = clientID
+	s.state.ClientSecret = clientSecret
+	return s.save()
+}
+
+func (s *tokenStore) GetToken(ctx context.Context) (*transport.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	token := s.state.Token
+	if s.config.grant() == grantClientCredentials &&
+		(token == nil || (!token.ExpiresAt.IsZero() && time.Now().Add(tokenExpiryMargin).After(token.ExpiresAt))) {
+		var err error
+		if token, err = s.requestClientCredentialsToken(ctx); err != nil {
+			return nil, err
+		}
+		s.state.Token = token
+		if err := s.save(); err != nil {
+			log.Error("Failed to save OAuth token", "file", s.path, "error", err)
+		}
+	}
+
+	if token == nil {
+		return nil, transport.ErrNoToken
+	}
+	return token, nil
+}
+
+func (s *tokenStore) SaveToken(ctx context.Context, token *transport.Token) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.state.Token = token
+	return s.save()
+}
+
+// requestClientCredentialsToken runs the client credentials grant against the token endpoint
+func (s *tokenStore) requestClientCredentialsToken(ctx context.Context) (*transport.Token, error) {
+	metadata, err := s.handler.GetServerMetadata(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server metadata: %w", err)
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", grantClientCredentials)
+	data.Set("client_id", s.config.ClientID)
+	data.Set("client_secret", s.config.ClientSecret)
+	if len(s.config.Scopes) > 0 {
+		data.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	var token transport.Token
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	log.Info("Obtained OAuth token", "grant", grantClientCredentials, "expires", token.ExpiresAt)
+	return &token, nil
+}
+
+// pendingAuthorization is an authorization code flow waiting for the user to sign in through the browser
+type pendingAuthorization struct {
+	server   string
+	verifier string
+	handler  *transport.OAuthHandler
+	started  time.Time
+}
+
+// oauthManager holds the gateway wide OAuth settings and the authorizations in progress
+type oauthManager struct {
+	lock        sync.Mutex
+	callbackURL string
+	tokenDir    string
+	pending     map[string]pendingAuthorization
+}
+
+func newOAuthManager() *oauthManager {
+	tokenDir := "oauth"
+	if dir, err := os.UserConfigDir(); err == nil {
+		tokenDir = filepath.Join(dir, "mcpgw", "oauth")
+	}
+
+	return &oauthManager{
+		tokenDir: tokenDir,
+		pending:  make(map[string]pendingAuthorization),
+	}
+}
+
+// canAuthorize returns true if the browser can find its way back to the gateway at the end of a server's authorization
+func (m *oauthManager) canAuthorize(config *OAuthConfig) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return config.RedirectURI != "" || m.callbackURL != ""
+}
+
+// store opens the token store of a server
+func (m *oauthManager) store(name string, config *OAuthConfig) (*tokenStore, error) {
+	path := config.TokenFile
+	if path == "" {
+		m.lock.Lock()
+		path = filepath.Join(m.tokenDir, name+".json")
+		m.lock.Unlock()
+	}
+	return loadTokenStore(path, config)
+}
+
+// clientConfig builds the mcp-go OAuth settings of a server backed by its token store
+func (m *oauthManager) clientConfig(config *OAuthConfig, store *tokenStore) transport.OAuthConfig {
+	redirectURI := config.RedirectURI
+	if redirectURI == "" {
+		m.lock.Lock()
+		redirectURI = m.callbackURL
+		m.lock.Unlock()
+	}
+
+	clientID, clientSecret := store.client()
+	return transport.OAuthConfig{
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		RedirectURI:           redirectURI,
+		Scopes:                config.Scopes,
+		TokenStore:            store,
+		AuthServerMetadataURL: config.MetadataURL,
+		PKCEEnabled:           true,
+	}
+}
+
+// handler creates an OAuth handler for the server at serverURL, used for discovery and the authorization flow
+func (m *oauthManager) handler(serverURL string, config transport.OAuthConfig) (*transport.OAuthHandler, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url: %w", err)
+	}
+
+	handler := transport.NewOAuthHandler(config)
+	handler.SetBaseURL(fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host))
+	return handler, nil
+}
+
+// transportConfig returns the OAuth settings to connect to a server with
+func (m *oauthManager) transportConfig(name string, serverURL string, config *OAuthConfig) (transport.OAuthConfig, error) {
+	store, err := m.store(name, config)
+	if err != nil {
+		return transport.OAuthConfig{}, err
+	}
+
+	clientConfig := m.clientConfig(config, store)
+	if store.handler, err = m.handler(serverURL, clientConfig); err != nil {
+		return transport.OAuthConfig{}, err
+	}
+	return clientConfig, nil
+}
+
+// begin starts the authorization code flow for a server and returns the url the user has to open
+func (m *oauthManager) begin(ctx context.Context, name string, serverURL string, config *OAuthConfig) (string, error) {
+	if config.grant() != grantAuthorizationCode {
+		return "", ErrNoOAuth
+	}
+
+	store, err := m.store(name, config)
+	if err != nil {
+		return "", err
+	}
+
+	clientConfig := m.clientConfig(config, store)
+	if clientConfig.RedirectURI == "" {
+		return "", fmt.Errorf("no OAuth redirect uri configured for %s", name)
+	}
+
+	handler, err := m.handler(serverURL, clientConfig)
+	if err != nil {
+		return "", err
+	}
+
+	if handler.GetClientID() == "" {
+		log.Info("Registering OAuth client", "server", name)
+		if err := handler.RegisterClient(ctx, oauthClientName); err != nil {
+			return "", fmt.Errorf("failed to register OAuth client: %w", err)
+		}
+		if err := store.saveClient(handler.GetClientID(), handler.GetClientSecret()); err != nil {
+			return "", fmt.Errorf("failed to save OAuth client: %w", err)
+		}
+	}
+
+	verifier, err := mcpclient.GenerateCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+	state, err := mcpclient.GenerateState()
+	if err != nil {
+		return "", err
+	}
+
+	authorizationURL, err := handler.GetAuthorizationURL(ctx, state, mcpclient.GenerateCodeChallenge(verifier))
+	if err != nil {
+		return "", err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key, pending := range m.pending {
+		if time.Since(pending.started) > authorizationTimeout {
+			delete(m.pending, key)
+		}
+	}
+	m.pending[state] = pendingAuthorization{
+		server:   name,
+		verifier: verifier,
+		handler:  handler,
+		started:  time.Now(),
+	}
+	return authorizationURL, nil
+}
+
+// complete exchanges the code returned by the authorization server for a token and returns the server it is for
+func (m *oauthManager) complete(ctx context.Context, state string, code string) (string, error) {
+	m.lock.Lock()
+	pending, ok := m.pending[state]
+	delete(m.pending, state)
+	m.lock.Unlock()
+
+	if !ok || time.Since(pending.started) > authorizationTimeout {
+		return "", ErrUnknownAuthorization
+	}
+
+	if err := pending.handler.ProcessAuthorizationResponse(ctx, code, state, pending.verifier); err != nil {
+		return "", err
+	}
+	return pending.server, nil
+}
+
+// WithOAuth sets the url authorization servers redirect the browser back to and the directory
+// where client registrations and tokens are kept, an empty tokenDir keeps the default.
+func (h *Host) WithOAuth(callbackURL string, tokenDir string) *Host {
+	h.oauth.lock.Lock()
+	defer h.oauth.lock.Unlock()
+
+	h.oauth.callbackURL = callbackURL
+	if tokenDir != "" {
+		h.oauth.tokenDir = tokenDir
+	}
+	return h
+}
+
+// AuthorizeServer starts the OAuth authorization code flow of a server. The returned url has to be
+// opened in a browser, the authorization server then redirects back to the gateway's callback.
+func (h *Host) AuthorizeServer(ctx context.Context, name string) (string, error) {
+	server, ok := h.serverConfig(name)
+	if !ok {
+		return "", ErrUnknownServer
+	}
+
+	serverURL, config, ok := remoteOAuth(server)
+	if !ok {
+		return "", ErrNoOAuth
+	}
+
+	log.Info("Starting OAuth authorization", "server", name)
+	return h.oauth.begin(ctx, name, serverURL, config)
+}
+
+// CompleteAuthorization finishes an authorization started by AuthorizeServer and reconnects the server
+// with the new token. It returns the name of the server that was authorized.
+func (h *Host) CompleteAuthorization(ctx context.Context, state string, code string) (string, error) {
+	name, err := h.oauth.complete(ctx, state, code)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info("OAuth authorization complete", "server", name)
+	if err := h.RestartServer(name); err != nil && !errors.Is(err, ErrServerDisabled) {
+		return name, err
+	}
+	return name, nil
+}
@@ -0,0 +1,273 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+)
+
+var (
+	// ErrUnknownPrompt is returned when a slash command names a prompt no running server provides
+	ErrUnknownPrompt = errors.New("unknown prompt")
+
+	// ErrPromptArguments is returned when the arguments of a slash command don't fit its prompt
+	ErrPromptArguments = errors.New("invalid prompt arguments")
+)
+
+// PromptDescription is a prompt template offered by one of the MCP servers.
+// Name is the namespaced name used to run it as a slash command: /server.prompt arg=value
+type PromptDescription struct {
+	Name        string               `json:"name"`
+	Server      string               `json:"server"`
+	Prompt      string               `json:"prompt"`
+	Description string               `json:"description,omitempty"`
+	Arguments   []mcp.PromptArgument `json:"arguments,omitempty"`
+}
+
+func promptName(server, prompt string) string {
+	return server + "." + prompt
+}
+
+// listPrompts lists the prompts of a server that supports them
+func listPrompts(name string, client mcpclient.MCPClient) []mcp.Prompt {
+	if capabilities, ok := serverCapabilities(client); ok && capabilities.Prompts == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := client.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	if err != nil {
+		log.Warn("Failed to list prompts", "name", name, "error", err)
+		return nil
+	}
+	return result.Prompts
+}
+
+// refreshPrompts lists the prompts of a running server again after it announced that they changed
+func (s *supervisor) refreshPrompts(ms *managedServer, client mcpclient.MCPClient) {
+	prompts := listPrompts(ms.name, client)
+
+	ms.lock.Lock()
+	if ms.client != client {
+		ms.lock.Unlock()
+		return
+	}
+	ms.prompts = prompts
+	ms.lock.Unlock()
+
+	log.Info("Server prompts changed", "name", ms.name, "prompts", len(prompts))
+
+	// the host tells its listeners about changes when the tools are rebuilt
+	s.toolsChanged()
+}
+
+// getPrompt renders a prompt of a running server
+func (s *supervisor) getPrompt(ctx context.Context, name string, prompt string, arguments map[string]string) (*mcp.GetPromptResult, error) {
+	ms, ok := s.server(name)
+	if !ok {
+		return nil, ErrUnknownServer
+	}
+
+	ms.lock.RLock()
+	client := ms.client
+	running := ms.state == ServerRunning
+	ms.lock.RUnlock()
+
+	if !running {
+		return nil, fmt.Errorf("server %s is not available right now", name)
+	}
+
+	req := mcp.GetPromptRequest{}
+	req.Params.Name = prompt
+	req.Params.Arguments = arguments
+	return client.GetPrompt(ctx, req)
+}
+
+// ListPrompts returns the prompts of every running server
+func (h *Host) ListPrompts() []PromptDescription {
+	descriptions := []PromptDescription{}
+	if h.servers == nil {
+		return descriptions
+	}
+
+	for _, name := range h.servers.names() {
+		ms, ok := h.servers.server(name)
+		if !ok {
+			continue
+		}
+
+		ms.lock.RLock()
+		for _, prompt := range ms.prompts {
+			descriptions = append(descriptions, PromptDescription{
+				Name:        promptName(name, prompt.Name),
+				Server:      name,
+				Prompt:      prompt.Name,
+				Description: prompt.Description,
+				Arguments:   prompt.Arguments,
+			})
+		}
+		ms.lock.RUnlock()
+	}
+
+	sort.Slice(descriptions, func(i, j int) bool {
+		return descriptions[i].Name < descriptions[j].Name
+	})
+	return descriptions
+}
+
+func (h *Host) resolvePrompt(name string) (PromptDescription, bool) {
+	for _, prompt := range h.ListPrompts() {
+		if prompt.Name == name {
+			return prompt, true
+		}
+	}
+	return PromptDescription{}, false
+}
+
+// RenderPrompt renders a namespaced prompt on the server that provides it
+func (h *Host) RenderPrompt(ctx context.Context, name string, arguments map[string]string) (*mcp.GetPromptResult, error) {
+	prompt, ok := h.resolvePrompt(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrompt, name)
+	}
+
+	if err := checkPromptArguments(prompt, arguments); err != nil {
+		return nil, err
+	}
+
+	result, err := h.servers.getPrompt(ctx, prompt.Server, prompt.Prompt, arguments)
+	if err != nil {
+		return nil, fmt.Errorf("error getting prompt %s: %w", name, err)
+	}
+	return result, nil
+}
+
+// GetPrompt renders a namespaced prompt into the messages it adds to a conversation
+func (h *Host) GetPrompt(ctx context.Context, name string, arguments map[string]string) ([]history.HistoryMessage, error) {
+	result, err := h.RenderPrompt(ctx, name, arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []history.HistoryMessage
+	for _, message := range result.Messages {
+		role := "user"
+		if message.Role == mcp.RoleAssistant {
+			role = "assistant"
+		}
+		messages = append(messages, history.HistoryMessage{
+			Role:    role,
+			Content: []history.ContentBlock{history.NewPromptBlock([]mcp.Content{message.Content})},
+		})
+	}
+	return messages, nil
+}
+
+// checkPromptArguments makes sure every required argument is given and no unknown ones are
+func checkPromptArguments(prompt PromptDescription, arguments map[string]string) error {
+	known := make(map[string]bool)
+	for _, argument := range prompt.Arguments {
+		known[argument.Name] = true
+		if _, ok := arguments[argument.Name]; argument.Required && !ok {
+			return fmt.Errorf("%w: %s needs %s", ErrPromptArguments, prompt.Name, argument.Name)
+		}
+	}
+
+	for name := range arguments {
+		if !known[name] {
+			return fmt.Errorf("%w: %s has no argument %s", ErrPromptArguments, prompt.Name, name)
+		}
+	}
+	return nil
+}
+
+// parseCommand splits a slash command into the prompt name and its name=value arguments.
+// Values can be quoted to contain spaces: /docs.summarize topic="release notes"
+func parseCommand(text string) (string, map[string]string, error) {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	inWord := false
+
+	for _, r := range text {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return "", nil, fmt.Errorf("%w: unterminated quote", ErrPromptArguments)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	arguments := make(map[string]string)
+	for _, w := range words[1:] {
+		name, value, ok := strings.Cut(w, "=")
+		if !ok || name == "" {
+			return "", nil, fmt.Errorf("%w: expected name=value, got %q", ErrPromptArguments, w)
+		}
+		arguments[name] = value
+	}
+
+	return strings.TrimPrefix(words[0], "/"), arguments, nil
+}
+
+// isCommand returns true if the prompt starts with a slash command naming one of the servers: /server.prompt
+func (h *Host) isCommand(prompt string) bool {
+	if !strings.HasPrefix(prompt, "/") || h.servers == nil {
+		return false
+	}
+
+	command := strings.Fields(prompt)[0][1:]
+	for _, name := range h.servers.names() {
+		if strings.HasPrefix(command, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandCommand expands a slash command into the messages of its prompt. ok is false when the
+// prompt is not a slash command and should be sent to the llm as it is.
+func (h *Host) ExpandCommand(ctx context.Context, prompt string) ([]history.HistoryMessage, bool, error) {
+	prompt = strings.TrimSpace(prompt)
+	if !h.isCommand(prompt) {
+		return nil, false, nil
+	}
+
+	name, arguments, err := parseCommand(prompt)
+	if err != nil {
+		return nil, true, err
+	}
+
+	log.Info("Expanding prompt", "prompt", name, "arguments", arguments)
+	messages, err := h.GetPrompt(ctx, name, arguments)
+	return messages, true, err
+}
@@ -0,0 +1,82 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ErrUnknownTool is returned when calling a tool no running server exposes
+var ErrUnknownTool = errors.New("unknown tool")
+
+// OnChange registers a function that is called whenever the tools, resources or prompts of the servers may have changed
+func (h *Host) OnChange(listener func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.listeners = append(h.listeners, listener)
+}
+
+func (h *Host) notifyChanged() {
+	h.lock.RLock()
+	listeners := h.listeners
+	h.lock.RUnlock()
+
+	for _, listener := range listeners {
+		listener()
+	}
+}
+
+// MCPTools returns the tools of every running server as MCP tools under their namespaced names, with the
+// filters and description overrides of the config applied. The gateway's own tools are not included.
+func (h *Host) MCPTools() []mcp.Tool {
+	tools := []mcp.Tool{}
+	_, names := h.toolset()
+	if h.servers == nil || names == nil {
+		return tools
+	}
+
+	for _, serverName := range h.servers.names() {
+		serverTools, ok := h.servers.tools(serverName)
+		if !ok {
+			continue
+		}
+
+		options, _ := h.serverOptions(serverName)
+		for _, tool := range options.filterTools(serverName, serverTools) {
+			alias, ok := names.alias(serverName, tool.Name)
+			if !ok {
+				continue
+			}
+			tool.Name = alias
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// ToolRequiresApproval returns true if calls to a namespaced tool need the user's approval
+func (h *Host) ToolRequiresApproval(name string) bool {
+	serverName, toolName, ok := h.resolveTool(name)
+	return ok && h.requiresApproval(serverName, toolName)
+}
+
+// CallTool calls a namespaced tool with the filters of the config applied. Approval policies are
+// left to the caller, see ToolRequiresApproval.
+func (h *Host) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	serverName, toolName, ok := h.resolveTool(name)
+	if !ok || serverName == builtinServer || !h.allowsTool(serverName, toolName) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTool, name)
+	}
+
+	mcpClient, ok := h.servers.client(serverName)
+	if !ok {
+		return nil, fmt.Errorf("the server providing tool %s is not available right now", name)
+	}
+
+	log.Info("Client Requests Tool Call", "tool_name", toolName, "tool_args", arguments, "server", serverName)
+	return h.dispatchTool(ctx, uuid.New().String(), mcpClient, serverName, toolName, arguments)
+}
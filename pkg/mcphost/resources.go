@@ -0,0 +1,352 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+)
+
+// ErrUnknownResource is returned when no running server provides a resource
+var ErrUnknownResource = errors.New("unknown resource")
+
+const (
+	// builtinServer is the server name of the tools the gateway implements itself
+	builtinServer    = ""
+	readResourceTool = "read_resource"
+
+	// maxListedResources bounds how many resources are listed in the description of the read_resource tool
+	maxListedResources = 50
+)
+
+// cachedResource is the content of a resource the gateway is subscribed to, it is dropped when the server reports an update
+type cachedResource struct {
+	contents []mcp.ResourceContents
+	read     time.Time
+}
+
+// ResourceDescription is a resource offered by one of the MCP servers
+type ResourceDescription struct {
+	Server      string `json:"server"`
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MIMEType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplateDescription is a parameterized resource (RFC 6570 uri template) offered by one of the MCP servers
+type ResourceTemplateDescription struct {
+	Server      string `json:"server"`
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MIMEType    string `json:"mimeType,omitempty"`
+}
+
+// serverCapabilities returns what the server announced during initialize, ok is false if the client can't tell
+func serverCapabilities(client mcpclient.MCPClient) (mcp.ServerCapabilities, bool) {
+	if c, ok := client.(*mcpclient.Client); ok {
+		return c.GetServerCapabilities(), true
+	}
+	return mcp.ServerCapabilities{}, false
+}
+
+// listResources lists the resources and resource templates of a server that supports them
+func listResources(name string, client mcpclient.MCPClient) ([]mcp.Resource, []mcp.ResourceTemplate) {
+	if capabilities, ok := serverCapabilities(client); ok && capabilities.Resources == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resources []mcp.Resource
+	if result, err := client.ListResources(ctx, mcp.ListResourcesRequest{}); err != nil {
+		log.Warn("Failed to list resources", "name", name, "error", err)
+	} else {
+		resources = result.Resources
+	}
+
+	var templates []mcp.ResourceTemplate
+	if result, err := client.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{}); err != nil {
+		log.Warn("Failed to list resource templates", "name", name, "error", err)
+	} else {
+		templates = result.ResourceTemplates
+	}
+
+	return resources, templates
+}
+
+// refreshResources lists the resources of a running server again after it announced that they changed
+func (s *supervisor) refreshResources(ms *managedServer, client mcpclient.MCPClient) {
+	resources, templates := listResources(ms.name, client)
+
+	ms.lock.Lock()
+	if ms.client != client {
+		ms.lock.Unlock()
+		return
+	}
+	ms.resources = resources
+	ms.templates = templates
+	ms.lock.Unlock()
+
+	log.Info("Server resources changed", "name", ms.name, "resources", len(resources), "templates", len(templates))
+
+	// the read_resource tool lists the resources in its description
+	s.toolsChanged()
+}
+
+// invalidate drops the cached content of a resource
+func (ms *managedServer) invalidate(uri string) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if _, ok := ms.cache[uri]; ok {
+		log.Debug("Resource updated", "name", ms.name, "uri", uri)
+		delete(ms.cache, uri)
+	}
+}
+
+// readResource reads a resource of a running server. Resources are cached only when the server lets the
+// gateway subscribe to them, so the cache is invalidated by the server's update notifications.
+func (s *supervisor) readResource(ctx context.Context, name string, uri string) ([]mcp.ResourceContents, error) {
+	ms, ok := s.server(name)
+	if !ok {
+		return nil, ErrUnknownServer
+	}
+
+	ms.lock.RLock()
+	client := ms.client
+	cached, hit := ms.cache[uri]
+	running := ms.state == ServerRunning
+	ms.lock.RUnlock()
+
+	if !running {
+		return nil, fmt.Errorf("server %s is not available right now", name)
+	}
+	if hit {
+		return cached.contents, nil
+	}
+
+	req := mcp.ReadResourceRequest{}
+	req.Params.URI = uri
+	result, err := client.ReadResource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if capabilities, ok := serverCapabilities(client); ok && capabilities.Resources != nil && capabilities.Resources.Subscribe {
+		subscribe := mcp.SubscribeRequest{}
+		subscribe.Params.URI = uri
+		if err := client.Subscribe(ctx, subscribe); err != nil {
+			log.Debug("Failed to subscribe to resource", "name", name, "uri", uri, "error", err)
+			return result.Contents, nil
+		}
+
+		ms.lock.Lock()
+		if ms.client == client {
+			ms.cache[uri] = cachedResource{
+				contents: result.Contents,
+				read:     time.Now(),
+			}
+		}
+		ms.lock.Unlock()
+	}
+
+	return result.Contents, nil
+}
+
+// ListResources returns the resources of every running server
+func (h *Host) ListResources() []ResourceDescription {
+	descriptions := []ResourceDescription{}
+	if h.servers == nil {
+		return descriptions
+	}
+
+	for _, name := range h.servers.names() {
+		ms, ok := h.servers.server(name)
+		if !ok {
+			continue
+		}
+
+		ms.lock.RLock()
+		for _, resource := range ms.resources {
+			descriptions = append(descriptions, ResourceDescription{
+				Server:      name,
+				URI:         resource.URI,
+				Name:        resource.Name,
+				Description: resource.Description,
+				MIMEType:    resource.MIMEType,
+			})
+		}
+		ms.lock.RUnlock()
+	}
+	return descriptions
+}
+
+// ListResourceTemplates returns the resource templates of every running server
+func (h *Host) ListResourceTemplates() []ResourceTemplateDescription {
+	descriptions := []ResourceTemplateDescription{}
+	if h.servers == nil {
+		return descriptions
+	}
+
+	for _, name := range h.servers.names() {
+		ms, ok := h.servers.server(name)
+		if !ok {
+			continue
+		}
+
+		ms.lock.RLock()
+		for _, template := range ms.templates {
+			uriTemplate := ""
+			if template.URITemplate != nil {
+				uriTemplate = template.URITemplate.Raw()
+			}
+			descriptions = append(descriptions, ResourceTemplateDescription{
+				Server:      name,
+				URITemplate: uriTemplate,
+				Name:        template.Name,
+				Description: template.Description,
+				MIMEType:    template.MIMEType,
+			})
+		}
+		ms.lock.RUnlock()
+	}
+	return descriptions
+}
+
+// resolveResource finds the server providing a resource, listed resources win over templates
+func (h *Host) resolveResource(uri string) (string, bool) {
+	for _, resource := range h.ListResources() {
+		if resource.URI == uri {
+			return resource.Server, true
+		}
+	}
+
+	for _, name := range h.servers.names() {
+		ms, ok := h.servers.server(name)
+		if !ok {
+			continue
+		}
+
+		ms.lock.RLock()
+		templates := ms.templates
+		ms.lock.RUnlock()
+		for _, template := range templates {
+			if template.URITemplate != nil && template.URITemplate.Regexp().MatchString(uri) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ReadResource reads a resource from the server that provides it
+func (h *Host) ReadResource(ctx context.Context, uri string) ([]mcp.ResourceContents, error) {
+	if h.servers == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownResource, uri)
+	}
+
+	server, ok := h.resolveResource(uri)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownResource, uri)
+	}
+	return h.servers.readResource(ctx, server, uri)
+}
+
+// ResourceBlocks reads resources and converts them into content blocks that can be attached to a user message
+func (h *Host) ResourceBlocks(ctx context.Context, uris []string) ([]history.ContentBlock, error) {
+	var blocks []history.ContentBlock
+	for _, uri := range uris {
+		contents, err := h.ReadResource(ctx, uri)
+		if err != nil {
+			return nil, fmt.Errorf("error reading resource %s: %w", uri, err)
+		}
+		blocks = append(blocks, history.NewResourceBlock(contents))
+	}
+	return blocks, nil
+}
+
+// readResourceToolDefinition describes the built-in tool that lets the llm read resources on demand
+func (h *Host) readResourceToolDefinition() mcp.Tool {
+	description := "Reads a resource provided by the connected servers by its URI."
+
+	resources := h.ListResources()
+	if len(resources) > 0 {
+		description += " Available resources:"
+		for i, resource := range resources {
+			if i == maxListedResources {
+				description += fmt.Sprintf("\n- and %d more", len(resources)-maxListedResources)
+				break
+			}
+			description += fmt.Sprintf("\n- %s (%s)", resource.URI, resource.Name)
+		}
+	}
+
+	templates := h.ListResourceTemplates()
+	if len(templates) > 0 {
+		description += "\nResource URI templates:"
+		for _, template := range templates {
+			description += fmt.Sprintf("\n- %s (%s)", template.URITemplate, template.Name)
+		}
+	}
+
+	return mcp.NewTool(readResourceTool,
+		mcp.WithDescription(description),
+		mcp.WithString("uri",
+			mcp.Required(),
+			mcp.Description("the URI of the resource to read"),
+		),
+	)
+}
+
+// builtinTools returns the tools the gateway implements itself, namespaced like the tools of the servers
+func (h *Host) builtinTools(names *toolNamespace) []llm.Tool {
+	h.lock.RLock()
+	enabled := h.config != nil && h.config.ResourceTool
+	h.lock.RUnlock()
+
+	if !enabled {
+		return nil
+	}
+	return mcpToolsToAnthropicTools(names, builtinServer, map[string]string{readResourceTool: readResourceTool}, []mcp.Tool{h.readResourceToolDefinition()})
+}
+
+// callBuiltinTool runs one of the gateway's own tools
+func (h *Host) callBuiltinTool(ctx context.Context, id string, name string, input json.RawMessage) history.ContentBlock {
+	if name != readResourceTool {
+		return history.NewToolError(id, h.unknownToolMessage(name))
+	}
+
+	var args struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(input, &args); err != nil || args.URI == "" {
+		return history.NewToolError(id, "Error: read_resource needs the uri of the resource to read")
+	}
+
+	log.Info("LLM Requests Resource", "uri", args.URI)
+	contents, err := h.ReadResource(ctx, args.URI)
+	if err != nil {
+		log.Warn("Resource read error", "uri", args.URI, "error", err)
+		return history.NewToolError(id, fmt.Sprintf("Error reading resource %s: %v", args.URI, err))
+	}
+
+	var content []mcp.Content
+	for _, c := range contents {
+		content = append(content, mcp.EmbeddedResource{Type: "resource", Resource: c})
+	}
+	if len(content) == 0 {
+		content = []mcp.Content{mcp.NewTextContent("The resource is empty.")}
+	}
+	return history.NewToolResult(id, content)
+}
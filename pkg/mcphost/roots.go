@@ -0,0 +1,98 @@
+package mcphost
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// RootConfig is a directory or URI a server may work in (MCP roots). In the config it can be given as a
+// plain path or URI, or as an object with a display name: {"uri": "/home/me/project", "name": "project"}
+type RootConfig struct {
+	URI  string `json:"uri"`
+	Name string `json:"name,omitempty"`
+}
+
+func (r *RootConfig) UnmarshalJSON(data []byte) error {
+	var uri string
+	if err := json.Unmarshal(data, &uri); err == nil {
+		r.URI = uri
+		return nil
+	}
+
+	type rootConfig RootConfig
+	return json.Unmarshal(data, (*rootConfig)(r))
+}
+
+// root converts the configured root into the one announced to the server, paths become file:// uris
+func (r RootConfig) root() mcp.Root {
+	uri := r.URI
+	if u, err := url.Parse(uri); err != nil || u.Scheme == "" {
+		path := uri
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		uri = (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+
+	return mcp.Root{URI: uri, Name: r.Name}
+}
+
+// rootsHandler answers the roots/list requests of one server from the current config
+type rootsHandler struct {
+	host   *Host
+	server string
+}
+
+func (r *rootsHandler) ListRoots(ctx context.Context, request mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	options, _ := r.host.serverOptions(r.server)
+
+	result := &mcp.ListRootsResult{Roots: []mcp.Root{}}
+	for _, root := range options.Roots {
+		result.Roots = append(result.Roots, root.root())
+	}
+
+	log.Debug("Server lists roots", "server", r.server, "roots", len(result.Roots))
+	return result, nil
+}
+
+// rootsChanged tells a running server that its roots changed so it lists them again
+func (s *supervisor) rootsChanged(name string) {
+	client, ok := s.client(name)
+	if !ok {
+		return
+	}
+
+	c, ok := client.(*mcpclient.Client)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.RootListChanges(ctx); err != nil {
+		log.Warn("Failed to notify server of changed roots", "name", name, "error", err)
+		return
+	}
+	log.Info("Server roots changed", "name", name)
+}
+
+// rootsUpdated returns true if a reload changed the roots of a server without adding or removing all of them
+func rootsUpdated(old, new ServerOptions) bool {
+	return len(old.Roots) > 0 && len(new.Roots) > 0 && !reflect.DeepEqual(old.Roots, new.Roots)
+}
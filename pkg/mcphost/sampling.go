@@ -0,0 +1,279 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+)
+
+// ErrNoPendingSampling is returned when resolving a sampling request that is not waiting for approval
+var ErrNoPendingSampling = errors.New("no pending sampling request")
+
+// samplingApprovalTimeout bounds how long a sampling request waits for the user before it is denied
+const samplingApprovalTimeout = 5 * time.Minute
+
+// SamplingPolicy lets a server ask the gateway's llm for completions (MCP sampling).
+// Servers without a policy are not offered sampling.
+type SamplingPolicy struct {
+	// Models are glob patterns (path.Match syntax) of the models the server may use, empty allows any
+	Models []string `json:"models,omitempty"`
+
+	// MaxTokens caps the length of a completion, larger requests are cut down to it
+	MaxTokens int `json:"maxTokens,omitempty"`
+
+	// RequireApproval holds every request until the user approves it
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// allows returns true if the server may sample with model
+func (p *SamplingPolicy) allows(model string) bool {
+	if len(p.Models) == 0 {
+		return true
+	}
+	for _, pattern := range p.Models {
+		if ok, _ := path.Match(pattern, model); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingSampling is a sampling request of a server that is waiting for the user to approve or deny it
+type PendingSampling struct {
+	ID           string                `json:"id"`
+	Server       string                `json:"server"`
+	SystemPrompt string                `json:"systemPrompt,omitempty"`
+	Messages     []mcp.SamplingMessage `json:"messages"`
+	MaxTokens    int                   `json:"maxTokens"`
+	Requested    time.Time             `json:"requested"`
+
+	decision chan bool
+}
+
+// samplingHandler answers the sampling requests of one server
+type samplingHandler struct {
+	host   *Host
+	server string
+}
+
+func (s *samplingHandler) CreateMessage(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	return s.host.sample(ctx, s.server, request)
+}
+
+// clientOptions returns the handlers installed on the connection to a server
+func (h *Host) clientOptions(name string) []mcpclient.ClientOption {
+	options := []mcpclient.ClientOption{
+		mcpclient.WithElicitationHandler(&elicitationHandler{host: h, server: name}),
+	}
+
+	serverOptions, ok := h.serverOptions(name)
+	if ok && serverOptions.Sampling != nil {
+		options = append(options, mcpclient.WithSamplingHandler(&samplingHandler{host: h, server: name}))
+	}
+	if ok && len(serverOptions.Roots) > 0 {
+		options = append(options, mcpclient.WithRootsHandler(&rootsHandler{host: h, server: name}))
+	}
+	return options
+}
+
+// sample runs a completion a server asked for, within the limits of its sampling policy
+func (h *Host) sample(ctx context.Context, server string, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	options, _ := h.serverOptions(server)
+	policy := options.Sampling
+	if policy == nil {
+		return nil, fmt.Errorf("sampling is not enabled for server %s", server)
+	}
+
+	if h.provider == nil {
+		return nil, fmt.Errorf("no llm provider is configured for sampling")
+	}
+
+	// the token cap and the server's system prompt are part of the policy, a provider that would ignore them can't sample
+	if _, ok := h.provider.(llm.Completer); !ok {
+		return nil, fmt.Errorf("the llm provider %s can't limit completions, sampling is not supported", h.provider.Name())
+	}
+
+	model := llm.ModelName(h.provider)
+	if !policy.allows(model) {
+		log.Warn("Sampling request denied", "server", server, "model", model)
+		return nil, fmt.Errorf("server %s may not use model %s", server, model)
+	}
+
+	maxTokens := request.MaxTokens
+	if policy.MaxTokens > 0 && (maxTokens <= 0 || maxTokens > policy.MaxTokens) {
+		maxTokens = policy.MaxTokens
+	}
+
+	var messages []llm.Message
+	for _, message := range request.Messages {
+		content, ok := message.Content.(mcp.Content)
+		if !ok {
+			return nil, fmt.Errorf("unsupported sampling content %T", message.Content)
+		}
+
+		role := "user"
+		if message.Role == mcp.RoleAssistant {
+			role = "assistant"
+		}
+		messages = append(messages, &history.HistoryMessage{
+			Role:    role,
+			Content: []history.ContentBlock{history.NewPromptBlock([]mcp.Content{content})},
+		})
+	}
+
+	if policy.RequireApproval {
+		if err := h.awaitSamplingApproval(ctx, server, request, maxTokens); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("Server requests sampling", "server", server, "messages", len(messages), "maxTokens", maxTokens)
+	message, err := llm.Complete(ctx, h.provider, messages, llm.CompletionOptions{
+		SystemPrompt:  request.SystemPrompt,
+		MaxTokens:     maxTokens,
+		Temperature:   request.Temperature,
+		StopSequences: request.StopSequences,
+	})
+	if err != nil {
+		log.Error("Sampling failed", "server", server, "error", err)
+		return nil, err
+	}
+
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{
+			Role:    mcp.RoleAssistant,
+			Content: mcp.NewTextContent(message.GetContent()),
+		},
+		Model:      model,
+		StopReason: "endTurn",
+	}, nil
+}
+
+// awaitSamplingApproval queues a sampling request and blocks until the user resolves it. During a call from a client
+// that can be asked the client approves it instead.
+func (h *Host) awaitSamplingApproval(ctx context.Context, server string, request mcp.CreateMessageRequest, maxTokens int) error {
+	if calls := h.events.running(server); len(calls) == 1 && calls[0].asker != nil {
+		return askSamplingApproval(calls[0].asker, server, request, maxTokens)
+	}
+	if h.unattended {
+		log.Warn("Sampling request needs an approval nobody can give, denying", "server", server)
+		return errors.New("the sampling request needs the user's approval but nobody can give it")
+	}
+
+	pending := &PendingSampling{
+		ID:           uuid.New().String(),
+		Server:       server,
+		SystemPrompt: request.SystemPrompt,
+		Messages:     request.Messages,
+		MaxTokens:    maxTokens,
+		Requested:    time.Now(),
+		decision:     make(chan bool, 1),
+	}
+
+	h.samplingLock.Lock()
+	if h.sampling == nil {
+		h.sampling = make(map[string]*PendingSampling)
+	}
+	h.sampling[pending.ID] = pending
+	h.samplingLock.Unlock()
+
+	defer func() {
+		h.samplingLock.Lock()
+		delete(h.sampling, pending.ID)
+		h.samplingLock.Unlock()
+	}()
+
+	log.Info("Sampling request waiting for approval", "server", server, "id", pending.ID)
+
+	timer := time.NewTimer(samplingApprovalTimeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-pending.decision:
+		if !approved {
+			return errors.New("the user declined the sampling request")
+		}
+		return nil
+	case <-timer.C:
+		return errors.New("the sampling request was not approved in time")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// askSamplingApproval has the user of a client approve a sampling request
+func askSamplingApproval(asker Asker, server string, request mcp.CreateMessageRequest, maxTokens int) error {
+	message := fmt.Sprintf("Allow the server %s to use the llm for a reply of up to %d tokens?", server, maxTokens)
+	if n := len(request.Messages); n > 0 {
+		if content, ok := request.Messages[n-1].Content.(mcp.TextContent); ok {
+			message += "\n\n" + content.Text
+		}
+	}
+
+	result, err := asker(mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: message,
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"approve": map[string]any{
+						"type":        "boolean",
+						"description": "run the sampling request",
+					},
+				},
+				"required": []string{"approve"},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not ask for approval of the sampling request: %w", err)
+	}
+
+	content, _ := result.Content.(map[string]any)
+	if approved, _ := content["approve"].(bool); result.Action != mcp.ElicitationResponseActionAccept || !approved {
+		return errors.New("the user declined the sampling request")
+	}
+	return nil
+}
+
+// PendingSamplings returns the sampling requests waiting for the user's approval, oldest first
+func (h *Host) PendingSamplings() []PendingSampling {
+	h.samplingLock.Lock()
+	defer h.samplingLock.Unlock()
+
+	pending := []PendingSampling{}
+	for _, p := range h.sampling {
+		pending = append(pending, *p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Requested.Before(pending[j].Requested)
+	})
+	return pending
+}
+
+// ResolveSampling approves or denies a sampling request that is waiting for the user
+func (h *Host) ResolveSampling(id string, approved bool) error {
+	h.samplingLock.Lock()
+	pending, ok := h.sampling[id]
+	delete(h.sampling, id)
+	h.samplingLock.Unlock()
+
+	if !ok {
+		return ErrNoPendingSampling
+	}
+
+	log.Info("Sampling request resolved", "server", pending.Server, "id", id, "approved", approved)
+	pending.decision <- approved
+	return nil
+}
@@ -0,0 +1,191 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+)
+
+var (
+	// ErrUnknownServer is returned when controlling a server that is not configured
+	ErrUnknownServer = errors.New("unknown MCP server")
+
+	// ErrServerDisabled is returned when restarting a server that was disabled
+	ErrServerDisabled = errors.New("MCP server is disabled")
+)
+
+// callStats accumulates the tool calls made to a server
+type callStats struct {
+	calls    int
+	errors   int
+	duration time.Duration
+	lastCall time.Time
+}
+
+// CallStats summarizes the tool calls made to a server since the gateway started
+type CallStats struct {
+	Calls          int        `json:"calls"`
+	Errors         int        `json:"errors"`
+	AverageLatency float64    `json:"averageLatency"`
+	LastCall       *time.Time `json:"lastCall,omitempty"`
+}
+
+// ServerStatus is a snapshot of the state of a configured MCP server
+type ServerStatus struct {
+	Name      string     `json:"name"`
+	Transport string     `json:"transport"`
+	State     string     `json:"state"`
+	Session   string     `json:"session,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	Uptime    float64    `json:"uptime"`
+	Restarts  int        `json:"restarts"`
+	LastError string     `json:"lastError,omitempty"`
+	Tools     int        `json:"tools"`
+	Calls     CallStats  `json:"calls"`
+}
+
+// record adds a finished tool call to the statistics of the server
+func (ms *managedServer) record(duration time.Duration, failed bool) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.stats.calls++
+	if failed {
+		ms.stats.errors++
+	}
+	ms.stats.duration += duration
+	ms.stats.lastCall = time.Now()
+}
+
+func (ms *managedServer) status() ServerStatus {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	status := ServerStatus{
+		Name:      ms.name,
+		Transport: ms.config.Config.GetType(),
+		State:     ms.state,
+		Session:   sessionID(ms.client),
+		Restarts:  ms.restarts,
+		Tools:     len(ms.tools),
+		Calls: CallStats{
+			Calls:  ms.stats.calls,
+			Errors: ms.stats.errors,
+		},
+	}
+
+	if ms.state == ServerRunning {
+		since := ms.started
+		status.Since = &since
+		status.Uptime = time.Since(ms.started).Seconds()
+	}
+	if ms.lastError != nil {
+		status.LastError = ms.lastError.Error()
+	}
+	if ms.stats.calls > 0 {
+		lastCall := ms.stats.lastCall
+		status.Calls.LastCall = &lastCall
+		status.Calls.AverageLatency = ms.stats.duration.Seconds() / float64(ms.stats.calls)
+	}
+	return status
+}
+
+// sessionID returns the MCP session of a connection, empty for transports without sessions
+func sessionID(client mcpclient.MCPClient) string {
+	if c, ok := client.(*mcpclient.Client); ok {
+		return c.GetSessionId()
+	}
+	return ""
+}
+
+// recordCall adds a tool call to the statistics of a server
+func (s *supervisor) recordCall(name string, duration time.Duration, failed bool) {
+	if ms, ok := s.server(name); ok {
+		ms.record(duration, failed)
+	}
+}
+
+// status returns a snapshot of every supervised server in a stable order
+func (s *supervisor) status() []ServerStatus {
+	statuses := []ServerStatus{}
+	for _, name := range s.names() {
+		if ms, ok := s.server(name); ok {
+			statuses = append(statuses, ms.status())
+		}
+	}
+	return statuses
+}
+
+// ServerStatus returns the state, uptime and call statistics of every configured MCP server
+func (h *Host) ServerStatus() []ServerStatus {
+	if h.servers == nil {
+		return []ServerStatus{}
+	}
+	return h.servers.status()
+}
+
+// RestartServer closes the connection to a server and starts it again
+func (h *Host) RestartServer(name string) error {
+	if h.servers == nil {
+		return ErrUnknownServer
+	}
+	return h.servers.restart(name)
+}
+
+// DisableServer stops a server and removes its tools until it is enabled again
+func (h *Host) DisableServer(name string) error {
+	if h.servers == nil {
+		return ErrUnknownServer
+	}
+	return h.servers.disable(name)
+}
+
+// EnableServer starts a server that was disabled
+func (h *Host) EnableServer(name string) error {
+	if h.servers == nil {
+		return ErrUnknownServer
+	}
+	return h.servers.enable(name)
+}
+
+// Health reports whether the gateway can serve chat requests
+type Health struct {
+	Ready         bool   `json:"ready"`
+	Provider      string `json:"provider"`
+	ProviderError string `json:"providerError,omitempty"`
+
+	// Servers counts the enabled servers, Degraded is set when some of them are not running
+	Servers  int  `json:"servers"`
+	Running  int  `json:"running"`
+	Degraded bool `json:"degraded"`
+}
+
+// CheckHealth checks that the llm provider is reachable and that the MCP servers are up.
+// The gateway is ready when the provider answers and at least one enabled server is running (or none are configured).
+func (h *Host) CheckHealth(ctx context.Context) Health {
+	health := Health{
+		Provider: h.provider.Name(),
+	}
+
+	if err := llm.CheckHealth(ctx, h.provider); err != nil {
+		health.ProviderError = err.Error()
+	}
+
+	for _, status := range h.ServerStatus() {
+		if status.State == ServerDisabled {
+			continue
+		}
+		health.Servers++
+		if status.State == ServerRunning {
+			health.Running++
+		}
+	}
+
+	health.Degraded = health.Running < health.Servers
+	health.Ready = health.ProviderError == "" && (health.Servers == 0 || health.Running > 0)
+	return health
+}
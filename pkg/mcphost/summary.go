@@ -0,0 +1,223 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+)
+
+// summaryTimeout bounds how long the llm may take to summarize, the conversation is pruned without a summary after
+const summaryTimeout = time.Minute
+
+// maxSummaryMessageLength caps how much of a single message goes into the summary prompt
+const maxSummaryMessageLength = 2000
+
+// DefaultSummaryPrompt asks for a summary that keeps what the assistant needs to carry on
+const DefaultSummaryPrompt = "Summarize the conversation below for an assistant that will continue it without seeing " +
+	"these messages. Keep facts about the user, their preferences, decisions made, open tasks and anything the user " +
+	"asked to remember. Be brief and reply with the summary only."
+
+// summaryHeader starts the message that carries the summary in the conversation
+const summaryHeader = "Summary of the earlier conversation:\n"
+
+// SummaryOptions configure how messages that fall out of the window are summarized
+type SummaryOptions struct {
+	// Prompt is the instruction for the llm, DefaultSummaryPrompt is used when empty
+	Prompt string
+
+	// Trigger is how many messages may pile up beyond the window before they are summarized,
+	// batching them saves an llm call on every turn
+	Trigger int
+
+	// MaxTokens caps the length of the summary, 0 leaves it to the provider
+	MaxTokens int
+}
+
+// Summarizer folds the messages pruned from conversations into a rolling summary kept after the system prompt
+type Summarizer struct {
+	provider llm.Provider
+	options  SummaryOptions
+}
+
+// NewSummarizer creates a summarizer, the provider may use a smaller model than the one running the conversations
+func NewSummarizer(provider llm.Provider, options SummaryOptions) *Summarizer {
+	if options.Prompt == "" {
+		options.Prompt = DefaultSummaryPrompt
+	}
+	return &Summarizer{
+		provider: provider,
+		options:  options,
+	}
+}
+
+// Summarize returns the previous summary updated with the messages
+func (s *Summarizer) Summarize(ctx context.Context, previous string, messages []history.HistoryMessage) (string, error) {
+	var prompt strings.Builder
+	prompt.WriteString(s.options.Prompt)
+	if previous != "" {
+		fmt.Fprintf(&prompt, "\n\nSummary so far:\n%s", previous)
+	}
+	prompt.WriteString("\n\nConversation:\n")
+	for _, message := range messages {
+		if line := summaryLine(message); line != "" {
+			prompt.WriteString(line)
+			prompt.WriteString("\n")
+		}
+	}
+
+	reply, err := llm.Complete(ctx, s.provider, []llm.Message{&history.HistoryMessage{
+		Role:    "user",
+		Content: []history.ContentBlock{{Type: "text", Text: prompt.String()}},
+	}}, llm.CompletionOptions{MaxTokens: s.options.MaxTokens})
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(reply.GetContent())
+	if summary == "" {
+		return "", fmt.Errorf("the llm returned an empty summary")
+	}
+	return summary, nil
+}
+
+// summaryLine renders a message for the summary prompt, tool calls are named as their arguments rarely matter later
+func summaryLine(message history.HistoryMessage) string {
+	text := message.GetContent()
+	if message.IsToolResponse() {
+		text = "[tool result] " + text
+	}
+	for _, block := range message.Content {
+		if block.Type == "tool_use" {
+			text = strings.TrimSpace(text + fmt.Sprintf(" [called %s]", block.Name))
+		}
+	}
+
+	if runes := []rune(strings.TrimSpace(text)); len(runes) > maxSummaryMessageLength {
+		text = string(runes[:maxSummaryMessageLength]) + "..."
+	}
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", message.Role, strings.TrimSpace(text))
+}
+
+// WithSummarizer has messages that fall out of a conversation's window summarized instead of dropped
+func (s *ConversationManager) WithSummarizer(summarizer *Summarizer) *ConversationManager {
+	s.summarizer = summarizer
+	return s
+}
+
+// summaryUpdateTimeout bounds the wait for a running turn before a summary is saved
+const summaryUpdateTimeout = time.Minute
+
+// errStaleSummary is returned when the conversation changed under a summary so it no longer applies
+var errStaleSummary = errors.New("the conversation changed while it was summarized")
+
+// needsSummary returns the messages to fold into the summary once enough of them are beyond the window.
+// The system prompt, the summary and the most recent messages add up to the window so pruning keeps them all.
+func (s *ConversationManager) needsSummary(conversation *Conversation) ([]history.HistoryMessage, bool) {
+	head, messages := splitSummary(conversation)
+	keep := max(conversation.Window-len(head)-1, 1)
+	if len(messages) <= keep+s.summarizer.options.Trigger {
+		return nil, false
+	}
+	return messages[:len(messages)-keep], true
+}
+
+// splitSummary splits the messages of a conversation into its system prompts, without the summary, and the others
+func splitSummary(conversation *Conversation) (head, messages []history.HistoryMessage) {
+	for i, message := range conversation.Messages {
+		if message.Role != "system" {
+			return head, conversation.Messages[i:]
+		}
+		if !conversation.isSummary(message) {
+			head = append(head, message)
+		}
+	}
+	return head, nil
+}
+
+// summarize folds the oldest messages of a stored conversation into its summary. It runs in the background once the
+// turn that stored the conversation is over so the reply isn't held up, conversation is the stored copy and is only
+// read. If the summary fails the conversation is pruned instead.
+func (s *ConversationManager) summarize(conversation *Conversation) {
+	s.lock.Lock()
+	if s.summarizing[conversation.Id] {
+		s.lock.Unlock()
+		return
+	}
+	s.summarizing[conversation.Id] = true
+	s.lock.Unlock()
+
+	go func() {
+		defer func() {
+			s.lock.Lock()
+			delete(s.summarizing, conversation.Id)
+			s.lock.Unlock()
+		}()
+
+		dropped, ok := s.needsSummary(conversation)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+		defer cancel()
+
+		start := time.Now()
+		summary, err := s.summarizer.Summarize(ctx, conversation.Recap, dropped)
+		update := func(current *Conversation) error {
+			current.Prune()
+			return nil
+		}
+		if err == nil {
+			update = func(current *Conversation) error {
+				return applySummary(current, conversation, dropped, summary)
+			}
+		} else {
+			log.Warn("Failed to summarize conversation, pruning without a summary", "session", conversation.Id, "error", err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), summaryUpdateTimeout)
+		defer cancel()
+		summarized := err == nil
+		if _, err := s.UpdateConversation(ctx, conversation.Id, update); err != nil {
+			log.Warn("Failed to save conversation summary", "session", conversation.Id, "error", err)
+			return
+		}
+		if summarized {
+			log.Info("Conversation summarized", "session", conversation.Id, "messages", len(dropped), "duration", time.Since(start))
+		}
+	}()
+}
+
+// applySummary replaces the messages that were summarized with the summary. Turns may have added messages since the
+// summarized copy was stored, they are kept. A summary of a branch that is no longer active, or of messages that
+// are gone, doesn't apply.
+func applySummary(conversation *Conversation, summarized *Conversation, dropped []history.HistoryMessage, summary string) error {
+	if conversation.Branch != summarized.Branch || conversation.Recap != summarized.Recap {
+		return errStaleSummary
+	}
+	last, ok := conversation.findMessage(dropped[len(dropped)-1].ID)
+	if !ok {
+		return errStaleSummary
+	}
+
+	head, _ := splitSummary(conversation)
+	conversation.Recap = summary
+	head = append(head, history.HistoryMessage{
+		ID:      uuid.New().String(),
+		Role:    "system",
+		Content: []history.ContentBlock{{Type: "text", Text: summaryHeader + summary}},
+	})
+	conversation.Messages = conversation.dropOrphans(append(head, conversation.Messages[last+1:]...))
+	return nil
+}
@@ -0,0 +1,70 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// waitForRecap polls the stored conversation until it has a summary
+func waitForRecap(t *testing.T, manager *ConversationManager, id string) *Conversation {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if conversation, ok, _ := manager.FindConversation(id); ok && conversation.Recap != "" {
+			return conversation
+		}
+	}
+	t.Fatal("the conversation was not summarized")
+	return nil
+}
+
+func TestSummarizeInTheBackground(t *testing.T) {
+	provider := &replyProvider{reply: "the user likes milk", release: make(chan struct{})}
+	manager := NewConversationManager("be nice").WithSummarizer(NewSummarizer(provider, SummaryOptions{Trigger: 4}))
+	ctx := context.Background()
+
+	conversation, _, err := manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 12; i++ {
+		appendExchange(conversation, fmt.Sprintf("question %d", i), "")
+	}
+
+	// handing the turn back must not wait for the llm
+	put := make(chan struct{})
+	go func() {
+		manager.PutConversation(conversation)
+		close(put)
+	}()
+	select {
+	case <-put:
+	case <-time.After(time.Second):
+		t.Fatal("storing the conversation waited for the summary")
+	}
+
+	// a turn that runs while the summary is written keeps its messages
+	conversation, _, err = manager.GetConversation(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendExchange(conversation, "latest", "")
+	manager.PutConversation(conversation)
+	close(provider.release)
+
+	stored := waitForRecap(t, manager, "c")
+	if stored.Recap != "the user likes milk" {
+		t.Errorf("summary is %q", stored.Recap)
+	}
+	if !stored.isSummary(stored.Messages[1]) {
+		t.Errorf("the summary doesn't follow the system prompt: %+v", stored.Messages[1])
+	}
+	if got := stored.Messages[len(stored.Messages)-2].GetContent(); got != "latest" {
+		t.Errorf("the last turn was lost, the last question is %q", got)
+	}
+	// the system prompt, the summary and the 14 most recent messages, plus the 2 of the turn that ran meanwhile
+	if len(stored.Messages) != stored.Window+2 {
+		t.Errorf("%d messages are kept, want %d", len(stored.Messages), stored.Window+2)
+	}
+}
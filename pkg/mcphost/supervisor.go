@@ -0,0 +1,671 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// pingInterval is how often a running server is checked for liveness
+	pingInterval = 30 * time.Second
+	pingTimeout  = 10 * time.Second
+
+	// startupTimeout bounds how long WithConfig waits for the first connection attempts
+	startupTimeout = 45 * time.Second
+
+	minRestartBackoff = time.Second
+	maxRestartBackoff = 2 * time.Minute
+
+	// stableUptime is how long a server has to stay up before its restart backoff starts over,
+	// a server that crashes sooner is restarted after the backoff
+	stableUptime = 3 * pingInterval
+)
+
+const (
+	ServerStarting = "starting"
+	ServerRunning  = "running"
+	ServerFailed   = "failed"
+	ServerStopped  = "stopped"
+	ServerDisabled = "disabled"
+
+	// ServerUnauthorized is a server waiting for the user to complete its OAuth authorization
+	ServerUnauthorized = "unauthorized"
+)
+
+// managedServer is a supervised connection to one MCP server
+type managedServer struct {
+	name   string
+	config ServerConfigWrapper
+
+	// control serializes starting and stopping the monitor
+	control sync.Mutex
+
+	lock      sync.RWMutex
+	client    mcpclient.MCPClient
+	tools     []mcp.Tool
+	resources []mcp.Resource
+	templates []mcp.ResourceTemplate
+	cache     map[string]cachedResource
+	prompts   []mcp.Prompt
+	state     string
+	lastError error
+	started   time.Time
+	restarts  int
+	disabled  bool
+	stats     callStats
+
+	// wake asks the monitor to check the server right away instead of waiting for the next ping
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// supervisor starts the configured MCP servers independently of each other, keeps checking
+// that they are alive and restarts or reconnects them with backoff when they are not.
+type supervisor struct {
+	lock    sync.RWMutex
+	servers map[string]*managedServer
+	oauth   *oauthManager
+
+	// clientOptions returns the handlers for the requests a server sends to the gateway
+	clientOptions func(name string) []mcpclient.ClientOption
+
+	// toolsChanged is called whenever the set of tools of a server may have changed
+	toolsChanged func()
+
+	// notified receives the progress and log notifications of the servers
+	notified func(name string, notification mcp.JSONRPCNotification)
+}
+
+func newSupervisor(
+	oauth *oauthManager,
+	clientOptions func(string) []mcpclient.ClientOption,
+	toolsChanged func(),
+	notified func(string, mcp.JSONRPCNotification),
+) *supervisor {
+	return &supervisor{
+		servers:       make(map[string]*managedServer),
+		oauth:         oauth,
+		clientOptions: clientOptions,
+		toolsChanged:  toolsChanged,
+		notified:      notified,
+	}
+}
+
+// start launches a monitor for every configured server and waits until each one had its first
+// connection attempt. Servers that fail keep retrying in the background.
+func (s *supervisor) start(config *MCPConfig) {
+	var wg sync.WaitGroup
+
+	for name, server := range config.MCPServers {
+		wg.Add(1)
+		s.add(name, server, wg.Done)
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(startupTimeout):
+		log.Warn("Timed out waiting for servers to start, continuing with the ones available")
+	}
+}
+
+// add starts supervising a server, started (if not nil) is called after its first connection attempt
+func (s *supervisor) add(name string, server ServerConfigWrapper, started func()) {
+	ms := &managedServer{
+		name:   name,
+		config: server,
+		state:  ServerStarting,
+		wake:   make(chan struct{}, 1),
+	}
+
+	s.lock.Lock()
+	s.servers[name] = ms
+	s.lock.Unlock()
+
+	s.launch(ms, started)
+}
+
+// launch starts the monitor of a server
+func (s *supervisor) launch(ms *managedServer, started func()) {
+	ms.lock.Lock()
+	ms.stop = make(chan struct{})
+	ms.done = make(chan struct{})
+	ms.lock.Unlock()
+
+	go s.monitor(ms, started)
+}
+
+// halt stops the monitor of a server (if it is running) and waits for it to close the connection
+func (ms *managedServer) halt() {
+	ms.lock.Lock()
+	stop, done := ms.stop, ms.done
+	ms.stop, ms.done = nil, nil
+	ms.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// remove stops supervising a server and closes its connection
+func (s *supervisor) remove(name string) {
+	s.lock.Lock()
+	ms, ok := s.servers[name]
+	delete(s.servers, name)
+	s.lock.Unlock()
+
+	if ok {
+		ms.control.Lock()
+		ms.halt()
+		ms.control.Unlock()
+	}
+}
+
+// replace swaps the config of a server and restarts it with the new one, a disabled server stays disabled
+func (s *supervisor) replace(name string, server ServerConfigWrapper) {
+	ms, ok := s.server(name)
+	if !ok {
+		s.add(name, server, nil)
+		return
+	}
+
+	ms.control.Lock()
+	defer ms.control.Unlock()
+
+	ms.halt()
+
+	ms.lock.Lock()
+	ms.config = server
+	disabled := ms.disabled
+	if disabled {
+		ms.state = ServerDisabled
+	}
+	ms.lock.Unlock()
+
+	if !disabled {
+		s.launch(ms, nil)
+	}
+}
+
+// restart closes the connection of a server and starts it again right away
+func (s *supervisor) restart(name string) error {
+	ms, ok := s.server(name)
+	if !ok {
+		return ErrUnknownServer
+	}
+
+	ms.control.Lock()
+	defer ms.control.Unlock()
+
+	ms.lock.RLock()
+	disabled := ms.disabled
+	ms.lock.RUnlock()
+	if disabled {
+		return ErrServerDisabled
+	}
+
+	log.Info("Restarting server", "name", name)
+	ms.halt()
+	s.launch(ms, nil)
+	return nil
+}
+
+// disable stops a server and keeps it stopped until it is enabled again
+func (s *supervisor) disable(name string) error {
+	ms, ok := s.server(name)
+	if !ok {
+		return ErrUnknownServer
+	}
+
+	ms.control.Lock()
+	defer ms.control.Unlock()
+
+	ms.lock.Lock()
+	if ms.disabled {
+		ms.lock.Unlock()
+		return nil
+	}
+	ms.disabled = true
+	ms.lock.Unlock()
+
+	log.Info("Disabling server", "name", name)
+	ms.halt()
+
+	ms.lock.Lock()
+	ms.state = ServerDisabled
+	ms.lock.Unlock()
+	return nil
+}
+
+// enable starts a disabled server again
+func (s *supervisor) enable(name string) error {
+	ms, ok := s.server(name)
+	if !ok {
+		return ErrUnknownServer
+	}
+
+	ms.control.Lock()
+	defer ms.control.Unlock()
+
+	ms.lock.Lock()
+	if !ms.disabled {
+		ms.lock.Unlock()
+		return nil
+	}
+	ms.disabled = false
+	ms.state = ServerStarting
+	ms.lock.Unlock()
+
+	log.Info("Enabling server", "name", name)
+	s.launch(ms, nil)
+	return nil
+}
+
+// names returns the supervised server names in a stable order
+func (s *supervisor) names() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	names := make([]string, 0, len(s.servers))
+	for name := range s.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *supervisor) server(name string) (*managedServer, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ms, ok := s.servers[name]
+	return ms, ok
+}
+
+// client returns the client of a running server
+func (s *supervisor) client(name string) (mcpclient.MCPClient, bool) {
+	ms, ok := s.server(name)
+	if !ok {
+		return nil, false
+	}
+
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.state != ServerRunning {
+		return nil, false
+	}
+	return ms.client, true
+}
+
+// tools returns the tools listed by a running server
+func (s *supervisor) tools(name string) ([]mcp.Tool, bool) {
+	ms, ok := s.server(name)
+	if !ok {
+		return nil, false
+	}
+
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	if ms.state != ServerRunning {
+		return nil, false
+	}
+	return ms.tools, true
+}
+
+// check wakes the monitor of a server so it verifies the connection right away
+func (s *supervisor) check(name string) {
+	if ms, ok := s.server(name); ok {
+		ms.poke()
+	}
+}
+
+// close stops every monitor and closes the server connections
+func (s *supervisor) close() {
+	s.lock.Lock()
+	servers := s.servers
+	s.servers = make(map[string]*managedServer)
+	s.lock.Unlock()
+
+	for _, ms := range servers {
+		ms.control.Lock()
+		ms.halt()
+		ms.control.Unlock()
+	}
+}
+
+// monitor owns the connection of one server for its whole life: it connects, pings and
+// reconnects with exponential backoff until the server is stopped.
+func (s *supervisor) monitor(ms *managedServer, started func()) {
+	ms.lock.RLock()
+	stop, done := ms.stop, ms.done
+	ms.lock.RUnlock()
+
+	defer close(done)
+	defer s.toolsChanged()
+	defer ms.disconnect(ServerStopped, nil)
+
+	backoff := minRestartBackoff
+	for {
+		err := s.connect(ms)
+		if started != nil {
+			started()
+			started = nil
+		}
+
+		if err == nil {
+			for {
+				if !ms.watch(stop) {
+					return
+				}
+				if !ms.reusable() {
+					break
+				}
+				reused, stopped := s.reuseSession(ms, stop)
+				if stopped {
+					return
+				}
+				if !reused {
+					break
+				}
+			}
+			// the server died, reconnect right away if it had been up for a while, else back off
+			ms.lock.RLock()
+			uptime := time.Since(ms.started)
+			ms.lock.RUnlock()
+
+			ms.disconnect(ServerFailed, ms.lastErr())
+			s.toolsChanged()
+			if uptime >= stableUptime {
+				backoff = minRestartBackoff
+				continue
+			}
+
+			log.Error("Server failed soon after starting", "name", ms.name, "uptime", uptime, "retry", backoff)
+			select {
+			case <-stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxRestartBackoff)
+			continue
+		}
+
+		if mcpclient.IsOAuthAuthorizationRequiredError(err) {
+			// retrying is pointless until the user authorized the gateway, which restarts the server
+			if _, config, ok := remoteOAuth(ms.config); ok && !s.oauth.canAuthorize(config) {
+				log.Error("Server can't be authorized", "name", ms.name, "error", ErrNoOAuthCallback)
+				ms.disconnect(ServerFailed, ErrNoOAuthCallback)
+			} else {
+				log.Warn("Server requires authorization", "name", ms.name)
+				ms.lock.Lock()
+				ms.state = ServerUnauthorized
+				ms.lock.Unlock()
+			}
+			s.toolsChanged()
+
+			select {
+			case <-stop:
+				return
+			case <-ms.wake:
+			}
+			continue
+		}
+
+		log.Error("Server unavailable", "name", ms.name, "error", err, "retry", backoff)
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// connect starts the server, lists its tools and publishes it as running
+func (s *supervisor) connect(ms *managedServer) error {
+	ms.lock.Lock()
+	restart := !ms.started.IsZero()
+	ms.state = ServerStarting
+	ms.lock.Unlock()
+
+	client, err := connectMCPServer(ms.name, ms.config, s.oauth, s.clientOptions(ms.name)...)
+	if err != nil {
+		ms.disconnect(ServerFailed, err)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	toolsResult, err := client.ListTools(ctx, mcp.ListToolsRequest{})
+	cancel()
+	if err != nil {
+		client.Close()
+		ms.disconnect(ServerFailed, err)
+		return err
+	}
+
+	if c, ok := client.(*mcpclient.Client); ok {
+		c.OnConnectionLost(func(err error) {
+			log.Warn("Server connection lost", "name", ms.name, "error", err)
+			ms.poke()
+		})
+	}
+
+	resources, templates := listResources(ms.name, client)
+	prompts := listPrompts(ms.name, client)
+
+	client.OnNotification(func(notification mcp.JSONRPCNotification) {
+		s.handleNotification(ms, client, notification)
+	})
+	setLogLevel(ms.name, client)
+
+	ms.lock.Lock()
+	ms.client = client
+	ms.tools = toolsResult.Tools
+	ms.resources = resources
+	ms.templates = templates
+	ms.cache = make(map[string]cachedResource)
+	ms.prompts = prompts
+	ms.state = ServerRunning
+	ms.lastError = nil
+	ms.started = time.Now()
+	if restart {
+		ms.restarts++
+	}
+	restarts := ms.restarts
+	ms.lock.Unlock()
+
+	log.Info("Server connected", "name", ms.name, "tools", len(toolsResult.Tools), "restarts", restarts)
+	s.toolsChanged()
+	return nil
+}
+
+// handleNotification reacts to the notifications a server sends.
+// They are delivered on the transport's reader, requests back to the server have to run on their own goroutine.
+func (s *supervisor) handleNotification(ms *managedServer, client mcpclient.MCPClient, notification mcp.JSONRPCNotification) {
+	switch notification.Method {
+	case mcp.MethodNotificationToolsListChanged:
+		go s.refreshTools(ms, client)
+
+	case mcp.MethodNotificationResourcesListChanged:
+		go s.refreshResources(ms, client)
+
+	case mcp.MethodNotificationPromptsListChanged:
+		go s.refreshPrompts(ms, client)
+
+	case methodNotificationProgress, methodNotificationMessage:
+		s.notified(ms.name, notification)
+
+	case mcp.MethodNotificationResourceUpdated:
+		if uri, ok := notification.Params.AdditionalFields["uri"].(string); ok {
+			ms.invalidate(uri)
+		}
+	}
+}
+
+// refreshTools lists the tools of a running server again after it announced that they changed
+func (s *supervisor) refreshTools(ms *managedServer, client mcpclient.MCPClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	toolsResult, err := client.ListTools(ctx, mcp.ListToolsRequest{})
+	cancel()
+	if err != nil {
+		log.Error("Failed to refresh tools", "name", ms.name, "error", err)
+		return
+	}
+
+	ms.lock.Lock()
+	if ms.client != client {
+		// the server was reconnected in the meantime, the new connection listed its own tools
+		ms.lock.Unlock()
+		return
+	}
+	ms.tools = toolsResult.Tools
+	ms.lock.Unlock()
+
+	log.Info("Server tools changed", "name", ms.name, "tools", len(toolsResult.Tools))
+	s.toolsChanged()
+}
+
+// watch pings the running server until it stops answering (returns true) or the server is stopped (returns false)
+func (ms *managedServer) watch(stop chan struct{}) bool {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+		case <-ms.wake:
+		}
+
+		if err := ms.ping(); err != nil {
+			log.Error("Server stopped responding", "name", ms.name, "error", err)
+			return true
+		}
+	}
+}
+
+// ping checks that the current connection answers and records the error if it does not
+func (ms *managedServer) ping() error {
+	ms.lock.RLock()
+	client := ms.client
+	ms.lock.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	err := client.Ping(ctx)
+	cancel()
+	if err != nil {
+		ms.lock.Lock()
+		ms.lastError = err
+		ms.lock.Unlock()
+	}
+	return err
+}
+
+// reusable returns true if the server has a streamable http session that may outlive the failure.
+// Each request of that transport is independent, so the session can be used again once the server is reachable.
+// Only the session is kept, responses that were being streamed are lost as the transport can't replay them.
+func (ms *managedServer) reusable() bool {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	if ms.config.Config.GetType() != transportStreamableHTTP || ms.client == nil {
+		return false
+	}
+	return unreachable(ms.lastError) && sessionID(ms.client) != ""
+}
+
+// unreachable returns true if err means the server could not be reached, as opposed to the server
+// answering with an error (for example because it no longer knows the session)
+func unreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// reuseSession keeps the session of an unreachable streamable http server and pings it with backoff until it
+// answers again (reused) or rejects the session, in which case it has to be reconnected with a new one.
+func (s *supervisor) reuseSession(ms *managedServer, stop chan struct{}) (reused bool, stopped bool) {
+	ms.lock.Lock()
+	ms.state = ServerFailed
+	ms.lock.Unlock()
+	s.toolsChanged()
+
+	backoff := minRestartBackoff
+	for {
+		log.Warn("Server unreachable, keeping session", "name", ms.name, "retry", backoff)
+		select {
+		case <-stop:
+			return false, true
+		case <-time.After(backoff):
+		}
+
+		err := ms.ping()
+		if err == nil {
+			ms.lock.Lock()
+			ms.state = ServerRunning
+			ms.lock.Unlock()
+
+			log.Info("Server session reused", "name", ms.name)
+			s.toolsChanged()
+			return true, false
+		}
+		if !unreachable(err) {
+			log.Warn("Server rejected the session", "name", ms.name, "error", err)
+			return false, false
+		}
+		backoff = min(backoff*2, maxRestartBackoff)
+	}
+}
+
+// poke wakes the monitor so it checks the server immediately
+func (ms *managedServer) poke() {
+	select {
+	case ms.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ms *managedServer) lastErr() error {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	return ms.lastError
+}
+
+// disconnect closes the current client (if any) and records the new state
+func (ms *managedServer) disconnect(state string, err error) {
+	ms.lock.Lock()
+	client := ms.client
+	ms.client = nil
+	ms.tools = nil
+	ms.resources = nil
+	ms.templates = nil
+	ms.cache = nil
+	ms.prompts = nil
+	ms.state = state
+	if err != nil {
+		ms.lastError = err
+	}
+	ms.lock.Unlock()
+
+	if client != nil {
+		if err := client.Close(); err != nil {
+			log.Error("Failed to close server", "name", ms.name, "error", err)
+		} else {
+			log.Info("Server closed", "name", ms.name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package mcphost
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+)
+
+// maxTitleLength caps the titles the llm comes up with
+const maxTitleLength = 80
+
+const titlePrompt = "Write a short title of at most six words for the conversation below. " +
+	"Reply with the title only, without quotes or punctuation at the end.\n\n"
+
+// titleTimeout bounds how long the llm may take to title a conversation, and the wait to save the title
+const titleTimeout = 30 * time.Second
+
+// titleRetryDelay is how long a conversation isn't titled again after an attempt, longer than an attempt can take
+const titleRetryDelay = 5 * time.Minute
+
+// startTitling claims a conversation for the llm to name, it returns false while another attempt runs or
+// shortly after one failed
+func (s *ConversationManager) startTitling(id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for titled, started := range s.titling {
+		if time.Since(started) >= titleRetryDelay {
+			delete(s.titling, titled)
+		}
+	}
+	if _, ok := s.titling[id]; ok {
+		return false
+	}
+	s.titling[id] = time.Now()
+	return true
+}
+
+// endTitling releases a conversation once it is titled, a failed attempt keeps it until the retry delay is over
+func (s *ConversationManager) endTitling(id string, titled bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if titled {
+		delete(s.titling, id)
+	} else {
+		s.titling[id] = time.Now()
+	}
+}
+
+// TitleConversation has the llm name a conversation after its first exchange. It runs in the background so the
+// reply isn't held up and saves the title through the manager, unless the conversation was named in the meantime.
+// Conversations that already have a title, are anonymous or have no reply yet are left alone.
+func (h *Host) TitleConversation(conversations *ConversationManager, conversation *Conversation) {
+	if conversation.Title != "" || conversation.Id == "" || h.provider == nil {
+		return
+	}
+
+	// the exchange is read now, the conversation belongs to its turn and may change once it is handed back
+	var question, answer string
+	for _, message := range conversation.Messages {
+		switch {
+		case message.Role == "user" && question == "":
+			question = message.GetContent()
+		case message.Role == "assistant" && question != "" && !llm.HasToolCalls(&message):
+			answer = message.GetContent()
+		}
+		if answer != "" {
+			break
+		}
+	}
+	if question == "" || answer == "" {
+		return
+	}
+
+	id := conversation.Id
+	if !conversations.startTitling(id) {
+		return
+	}
+
+	go func() {
+		titled := false
+		defer func() {
+			conversations.endTitling(id, titled)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+		defer cancel()
+
+		prompt := fmt.Sprintf("%sUser: %s\nAssistant: %s", titlePrompt, question, answer)
+		reply, err := llm.Complete(ctx, h.provider, []llm.Message{&history.HistoryMessage{
+			Role:    "user",
+			Content: []history.ContentBlock{{Type: "text", Text: prompt}},
+		}}, llm.CompletionOptions{MaxTokens: 32})
+		if err != nil {
+			log.Warn("Failed to title conversation", "session", id, "error", err)
+			return
+		}
+
+		title := cleanTitle(reply.GetContent())
+		if title == "" {
+			return
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), titleTimeout)
+		defer cancel()
+		_, err = conversations.UpdateConversation(ctx, id, func(conversation *Conversation) error {
+			if conversation.Title == "" {
+				conversation.Title = title
+			}
+			return nil
+		})
+		if err != nil {
+			log.Warn("Failed to save conversation title", "session", id, "error", err)
+			return
+		}
+		titled = true
+		log.Info("Conversation titled", "session", id, "title", title)
+	}()
+}
+
+// cleanTitle keeps the first line of the reply without the quotes and punctuation models like to add
+func cleanTitle(title string) string {
+	title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(strings.TrimSpace(title), "\"'*.`")
+
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength]))
+	}
+	return title
+}
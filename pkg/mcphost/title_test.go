@@ -0,0 +1,166 @@
+package mcphost
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+)
+
+// replyProvider answers every request with the same text, after release is closed if it is set, or fails with err
+type replyProvider struct {
+	reply   string
+	err     error
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (p *replyProvider) CreateMessage(ctx context.Context, prompt string, messages []llm.Message, tools []llm.Tool) (llm.Message, error) {
+	p.calls.Add(1)
+	if p.release != nil {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &history.HistoryMessage{Role: "assistant", Content: []history.ContentBlock{{Type: "text", Text: p.reply}}}, nil
+}
+
+func (p *replyProvider) CreateToolResponse(toolCallID string, content interface{}) (llm.Message, error) {
+	return nil, nil
+}
+
+func (p *replyProvider) SupportsTools() bool { return false }
+
+func (p *replyProvider) Name() string { return "reply" }
+
+// waitFor polls until done returns true
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if done() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// waitForTitle polls the stored conversation until it has a title
+func waitForTitle(t *testing.T, manager *ConversationManager, id string) string {
+	t.Helper()
+	var title string
+	waitFor(t, "the title", func() bool {
+		if conversation, ok, _ := manager.FindConversation(id); ok {
+			title = conversation.Title
+		}
+		return title != ""
+	})
+	return title
+}
+
+// titling returns true while the conversation is being titled or its last attempt failed
+func titling(manager *ConversationManager, id string) bool {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	_, ok := manager.titling[id]
+	return ok
+}
+
+func TestTitleConversation(t *testing.T) {
+	provider := &replyProvider{reply: "\"Shopping list.\"\nbecause you asked", release: make(chan struct{})}
+	host := &Host{provider: provider}
+	manager := NewConversationManager("be nice")
+
+	conversation, _, err := manager.GetConversation(context.Background(), "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendExchange(conversation, "what's on my list?", "")
+
+	// titling must not wait for the llm, nor for the turn to be handed back
+	host.TitleConversation(manager, conversation)
+	manager.PutConversation(conversation)
+	close(provider.release)
+
+	if title := waitForTitle(t, manager, "c"); title != "Shopping list" {
+		t.Errorf("title is %q, want Shopping list", title)
+	}
+}
+
+func TestTitleConversationKeepsARename(t *testing.T) {
+	provider := &replyProvider{reply: "Shopping list", release: make(chan struct{})}
+	host := &Host{provider: provider}
+	manager := NewConversationManager("be nice")
+
+	conversation, _, err := manager.GetConversation(context.Background(), "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendExchange(conversation, "what's on my list?", "")
+	host.TitleConversation(manager, conversation)
+	manager.PutConversation(conversation)
+
+	// the user names the conversation while the llm is still coming up with a title
+	_, err = manager.UpdateConversation(context.Background(), "c", func(conversation *Conversation) error {
+		conversation.Title = "Groceries"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(provider.release)
+
+	// the title is saved through a queued update once the llm answered
+	waitFor(t, "the title to be saved", func() bool {
+		return provider.calls.Load() == 1 && !titling(manager, "c")
+	})
+	stored, _, _ := manager.FindConversation("c")
+	if stored.Title != "Groceries" {
+		t.Errorf("title is %q, want the user's Groceries", stored.Title)
+	}
+}
+
+func TestTitleConversationOnceAtATime(t *testing.T) {
+	provider := &replyProvider{reply: "Shopping list", err: errors.New("the llm is down"), release: make(chan struct{})}
+	host := &Host{provider: provider}
+	manager := NewConversationManager("be nice")
+
+	conversation, _, err := manager.GetConversation(context.Background(), "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendExchange(conversation, "what's on my list?", "")
+	manager.PutConversation(conversation)
+
+	// turns in quick succession while the llm is still busy with the first title
+	host.TitleConversation(manager, conversation)
+	manager.lock.Lock()
+	started := manager.titling["c"]
+	manager.lock.Unlock()
+	host.TitleConversation(manager, conversation)
+	close(provider.release)
+
+	waitFor(t, "the failed attempt to be recorded", func() bool {
+		manager.lock.Lock()
+		defer manager.lock.Unlock()
+		return manager.titling["c"].After(started)
+	})
+
+	// a failed attempt isn't retried on the next turn either, give a wrongly started one the time to reach the llm
+	host.TitleConversation(manager, conversation)
+	time.Sleep(50 * time.Millisecond)
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("the llm was asked for a title %d times, want once", calls)
+	}
+	if !titling(manager, "c") {
+		t.Error("the failed attempt doesn't hold off the next one")
+	}
+}
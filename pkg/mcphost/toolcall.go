@@ -0,0 +1,113 @@
+package mcphost
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+)
+
+// maxToolSuggestions limits the "did you mean" list returned for unknown tools
+const maxToolSuggestions = 3
+
+// identifiedToolCall overrides the id of a tool call that came without a usable one
+type identifiedToolCall struct {
+	llm.ToolCall
+	id string
+}
+
+func (c *identifiedToolCall) GetID() string {
+	return c.id
+}
+
+// withToolCallIDs makes sure every tool call of a reply has a unique, stable id.
+// Some providers (ollama) don't send ids, without them tool uses and results can't be paired.
+func withToolCallIDs(calls []llm.ToolCall) []llm.ToolCall {
+	stamp := time.Now().UnixNano()
+	seen := make(map[string]bool)
+
+	result := make([]llm.ToolCall, len(calls))
+	for i, call := range calls {
+		if id := call.GetID(); id != "" && !seen[id] {
+			seen[id] = true
+			result[i] = call
+			continue
+		}
+
+		id := fmt.Sprintf("call_%x_%d", stamp, i)
+		seen[id] = true
+		result[i] = &identifiedToolCall{ToolCall: call, id: id}
+	}
+	return result
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// suggestTools returns the names of the exposed tools closest to name
+func (h *Host) suggestTools(name string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	lower := strings.ToLower(name)
+	var candidates []candidate
+	tools, names := h.toolset()
+	for _, tool := range tools {
+		distance := levenshtein(lower, strings.ToLower(tool.Name))
+
+		// the llm often drops the server prefix, compare against the bare tool name as well
+		if ref, ok := names.resolve(tool.Name); ok {
+			distance = min(distance, levenshtein(lower, strings.ToLower(ref.Tool)))
+		}
+
+		if distance <= max(3, len(name)/3) {
+			candidates = append(candidates, candidate{name: tool.Name, distance: distance})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxToolSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].name)
+	}
+	return suggestions
+}
+
+// unknownToolMessage builds the error result sent to the llm when it calls a tool that does not exist
+func (h *Host) unknownToolMessage(name string) string {
+	msg := fmt.Sprintf("Error: there is no tool named %q.", name)
+	if suggestions := h.suggestTools(name); len(suggestions) > 0 {
+		msg += fmt.Sprintf(" Did you mean: %s?", strings.Join(suggestions, ", "))
+	}
+	return msg
+}
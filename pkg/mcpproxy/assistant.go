@@ -0,0 +1,103 @@
+package mcpproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/mcphost"
+)
+
+// AskAssistantTool is the tool that hands a whole task to the gateway's llm and its tools
+const AskAssistantTool = "ask_assistant"
+
+// WithAssistant publishes the ask_assistant tool. It runs prompts with the host's llm and tools, conversations
+// start with the system prompt and are kept by id so callers can follow up on an answer.
+func (p *Proxy) WithAssistant(systemPrompt string) *Proxy {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.conversations = mcphost.NewConversationManager(systemPrompt)
+	p.setTools()
+	return p
+}
+
+func askAssistantToolDefinition() mcp.Tool {
+	return mcp.NewTool(AskAssistantTool,
+		mcp.WithDescription("Asks an assistant with access to its own tools to carry out a task and returns its final answer. "+
+			"Give the same conversation_id to follow up on an earlier answer."),
+		mcp.WithString("prompt",
+			mcp.Required(),
+			mcp.Description("the task or question for the assistant"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("any id of your choosing to continue a conversation across calls, leave it out for a one-off task"),
+		),
+	)
+}
+
+// askAssistant runs a prompt to completion and returns the assistant's answer and the images of its last turn
+func (p *Proxy) askAssistant(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	prompt, err := request.RequireString("prompt")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// questions the servers ask during the assistant's tool calls go to the client
+	if asker, ok := p.asker(ctx); ok {
+		ctx = mcphost.WithAsker(ctx, asker)
+	}
+
+	conversation, ctx, err := p.conversations.GetConversation(ctx, request.GetString("conversation_id", ""))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("The assistant is unavailable: %v", err)), nil
+	}
+	defer p.conversations.PutConversation(conversation)
+
+	log.Info("Assistant Request Started", "session", conversation.Id, "prompt", prompt)
+	if err := p.host.RunPrompt(ctx, prompt, conversation); err != nil {
+		log.Errorf("Error running prompt: %v", err)
+		return mcp.NewToolResultError(fmt.Sprintf("The assistant failed: %v", err)), nil
+	}
+
+	// tool calls that need approval are confirmed with the user through the client
+	for len(conversation.Pending) > 0 {
+		call := conversation.Pending[0]
+
+		var arguments map[string]any
+		json.Unmarshal(call.Arguments, &arguments)
+
+		approved, err := p.approve(ctx, call.Name, arguments)
+		if err != nil {
+			log.Warn("Could not ask for approval", "tool", call.Name, "error", err)
+		}
+
+		if err := p.host.ResolveApproval(ctx, conversation, call.ID, approved); err != nil {
+			log.Errorf("Error resolving approval: %v", err)
+			return mcp.NewToolResultError(fmt.Sprintf("The assistant failed: %v", err)), nil
+		}
+	}
+
+	response := conversation.LastResponse()
+	log.Info("Assistant Request Completed", "session", conversation.Id)
+
+	content := []mcp.Content{mcp.NewTextContent(response.Message)}
+	for _, image := range response.Images {
+		content = append(content, mcp.NewImageContent(image, imageMIMEType(image)))
+	}
+	return &mcp.CallToolResult{Content: content}, nil
+}
+
+// imageMIMEType sniffs the type of a base64 encoded image, the conversation only keeps the data
+func imageMIMEType(image string) string {
+	data, err := base64.StdEncoding.DecodeString(image)
+	if err != nil {
+		return "image/png"
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,79 @@
+package mcpproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/thirdmartini/mcpgw/pkg/mcphost"
+)
+
+const (
+	// OAuthAuthorizePath starts the OAuth authorization of the server named by the server query parameter
+	OAuthAuthorizePath = "/oauth/authorize"
+	// OAuthCallbackPath is where authorization servers redirect the browser back to after the user signed in
+	OAuthCallbackPath = "/oauth/callback"
+)
+
+// OAuthCallbackURL returns the OAuth callback of a proxy listening on listen
+func OAuthCallbackURL(listen string) string {
+	if strings.HasPrefix(listen, ":") {
+		listen = "localhost" + listen
+	}
+	return "http://" + listen + OAuthCallbackPath
+}
+
+// authorizeServer handles HTTP POST requests that start the OAuth authorization of a server. The returned
+// authorizationUrl has to be opened in a browser, the authorization server then redirects back to the proxy.
+func (p *Proxy) authorizeServer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("server")
+	log.Info("Server Authorization Request", "server", name)
+
+	authorizationURL, err := p.host.AuthorizeServer(r.Context(), name)
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case errors.Is(err, mcphost.ErrUnknownServer):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, mcphost.ErrNoOAuth):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		log.Errorf("Error starting authorization: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"authorizationUrl": authorizationURL})
+}
+
+// completeAuthorization handles the browser redirect from an authorization server at the end of an authorization
+func (p *Proxy) completeAuthorization(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if errorCode := query.Get("error"); errorCode != "" {
+		log.Error("Authorization failed", "error", errorCode, "description", query.Get("error_description"))
+		http.Error(w, "Authorization failed: "+errorCode+" "+query.Get("error_description"), http.StatusBadRequest)
+		return
+	}
+
+	name, err := p.host.CompleteAuthorization(r.Context(), query.Get("state"), query.Get("code"))
+	if err != nil {
+		log.Errorf("Error completing authorization: %v", err)
+		http.Error(w, "Authorization failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("mcpGW is now authorized to use " + name + ", you can close this window.\n"))
+}
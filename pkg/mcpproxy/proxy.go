@@ -0,0 +1,267 @@
+// Package mcpproxy serves the MCP servers of a host as one aggregated MCP server, so MCP clients can connect
+// once to the gateway instead of starting every server themselves.
+package mcpproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/thirdmartini/mcpgw/pkg/mcphost"
+)
+
+const (
+	// StreamableHTTPPath is where the proxy serves the Streamable HTTP transport
+	StreamableHTTPPath = "/mcp"
+	// SSEPath and MessagePath are the endpoints of the SSE transport
+	SSEPath     = "/sse"
+	MessagePath = "/message"
+)
+
+// declinedToolResult is returned to the client when the user doesn't approve a tool call
+const declinedToolResult = "The user declined to run this tool call."
+
+// Proxy exposes the tools, resources and prompts of every server of a host under their namespaced names.
+// The lists follow the host as servers come and go or change what they offer.
+type Proxy struct {
+	host   *mcphost.Host
+	server *server.MCPServer
+
+	lock      sync.Mutex
+	tools     []mcp.Tool
+	resources []mcphost.ResourceDescription
+	templates []mcphost.ResourceTemplateDescription
+	prompts   []mcphost.PromptDescription
+
+	// conversations are the conversations of the ask_assistant tool, it is only offered when they are set
+	conversations *mcphost.ConversationManager
+}
+
+// NewProxy creates the aggregated MCP server of a host
+func NewProxy(host *mcphost.Host, name, version string) *Proxy {
+	p := &Proxy{
+		host: host,
+		server: server.NewMCPServer(name, version,
+			server.WithToolCapabilities(true),
+			server.WithResourceCapabilities(false, true),
+			server.WithPromptCapabilities(true),
+		),
+	}
+
+	host.OnChange(p.sync)
+	p.sync()
+	return p
+}
+
+// sync brings the lists of the MCP server up to date with the host, clients are only notified of actual changes
+func (p *Proxy) sync() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if tools := p.host.MCPTools(); !reflect.DeepEqual(tools, p.tools) {
+		p.tools = tools
+		p.setTools()
+	}
+
+	if resources := p.host.ListResources(); !reflect.DeepEqual(resources, p.resources) {
+		p.resources = resources
+
+		serverResources := make([]server.ServerResource, 0, len(resources))
+		for _, resource := range resources {
+			serverResources = append(serverResources, server.ServerResource{
+				Resource: mcp.NewResource(resource.URI, resource.Name,
+					mcp.WithResourceDescription(resource.Description),
+					mcp.WithMIMEType(resource.MIMEType),
+				),
+				Handler: p.readResource,
+			})
+		}
+		p.server.SetResources(serverResources...)
+		log.Debug("Proxy resources changed", "resources", len(resources))
+	}
+
+	if templates := p.host.ListResourceTemplates(); !reflect.DeepEqual(templates, p.templates) {
+		p.templates = templates
+
+		serverTemplates := make([]server.ServerResourceTemplate, 0, len(templates))
+		for _, template := range templates {
+			serverTemplates = append(serverTemplates, server.ServerResourceTemplate{
+				Template: mcp.NewResourceTemplate(template.URITemplate, template.Name,
+					mcp.WithTemplateDescription(template.Description),
+					mcp.WithTemplateMIMEType(template.MIMEType),
+				),
+				Handler: p.readResource,
+			})
+		}
+		p.server.SetResourceTemplates(serverTemplates...)
+		log.Debug("Proxy resource templates changed", "templates", len(templates))
+	}
+
+	if prompts := p.host.ListPrompts(); !reflect.DeepEqual(prompts, p.prompts) {
+		p.prompts = prompts
+
+		serverPrompts := make([]server.ServerPrompt, 0, len(prompts))
+		for _, description := range prompts {
+			prompt := mcp.NewPrompt(description.Name, mcp.WithPromptDescription(description.Description))
+			prompt.Arguments = description.Arguments
+			serverPrompts = append(serverPrompts, server.ServerPrompt{Prompt: prompt, Handler: p.getPrompt})
+		}
+		p.server.SetPrompts(serverPrompts...)
+		log.Debug("Proxy prompts changed", "prompts", len(prompts))
+	}
+}
+
+// setTools publishes the proxied tools and the assistant
+func (p *Proxy) setTools() {
+	serverTools := make([]server.ServerTool, 0, len(p.tools)+1)
+	for _, tool := range p.tools {
+		if p.conversations != nil && tool.Name == AskAssistantTool {
+			log.Warn("Tool hidden by the assistant", "tool", tool.Name)
+			continue
+		}
+		serverTools = append(serverTools, server.ServerTool{Tool: tool, Handler: p.callTool})
+	}
+	if p.conversations != nil {
+		serverTools = append(serverTools, server.ServerTool{Tool: askAssistantToolDefinition(), Handler: p.askAssistant})
+	}
+
+	p.server.SetTools(serverTools...)
+	log.Debug("Proxy tools changed", "tools", len(serverTools))
+}
+
+// callTool forwards a tool call to the server behind the namespaced name. Tools that require approval
+// are confirmed with the user through the client first.
+func (p *Proxy) callTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name := request.Params.Name
+	arguments := request.GetArguments()
+
+	// questions the server asks during the call go to the client too
+	if asker, ok := p.asker(ctx); ok {
+		ctx = mcphost.WithAsker(ctx, asker)
+	}
+
+	if p.host.ToolRequiresApproval(name) {
+		approved, err := p.approve(ctx, name, arguments)
+		if err != nil {
+			log.Warn("Could not ask for approval", "tool", name, "error", err)
+			return mcp.NewToolResultError(fmt.Sprintf("The tool %s requires the user's approval but the client could not ask for it.", name)), nil
+		}
+		if !approved {
+			return mcp.NewToolResultText(declinedToolResult), nil
+		}
+	}
+
+	result, err := p.host.CallTool(ctx, name, arguments)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error calling tool %s: %v", name, err)), nil
+	}
+	return result, nil
+}
+
+// asker returns what puts questions to the user of the client of a request, ok is false if the client can't be asked
+func (p *Proxy) asker(ctx context.Context) (mcphost.Asker, bool) {
+	// clients that don't declare elicitation would leave the request unanswered
+	session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo)
+	if !ok || session.GetClientCapabilities().Elicitation == nil {
+		return nil, false
+	}
+
+	return func(request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+		return p.server.RequestElicitation(ctx, request)
+	}, true
+}
+
+// approve asks the user of the client whether a tool call may run
+func (p *Proxy) approve(ctx context.Context, name string, arguments map[string]any) (bool, error) {
+	ask, ok := p.asker(ctx)
+	if !ok {
+		return false, errors.New("the client does not support elicitation")
+	}
+
+	result, err := ask(mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: fmt.Sprintf("Allow the tool %s to run with %v?", name, arguments),
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"approve": map[string]any{
+						"type":        "boolean",
+						"description": "run the tool",
+					},
+				},
+				"required": []string{"approve"},
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.Action != mcp.ElicitationResponseActionAccept {
+		return false, nil
+	}
+
+	content, _ := result.Content.(map[string]any)
+	approved, _ := content["approve"].(bool)
+	return approved, nil
+}
+
+func (p *Proxy) readResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return p.host.ReadResource(ctx, request.Params.URI)
+}
+
+func (p *Proxy) getPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	return p.host.RenderPrompt(ctx, request.Params.Name, request.Params.Arguments)
+}
+
+// ServeStdio serves the proxy on stdin and stdout until the input is closed
+func (p *Proxy) ServeStdio() error {
+	return server.ServeStdio(p.server)
+}
+
+// Handler serves the proxy over Streamable HTTP and SSE along with the OAuth authorization of its servers.
+// When token is set every request but the OAuth callback has to carry it as a bearer token.
+func (p *Proxy) Handler(token string) http.Handler {
+	sse := server.NewSSEServer(p.server,
+		server.WithSSEEndpoint(SSEPath),
+		server.WithMessageEndpoint(MessagePath),
+	)
+
+	protected := http.NewServeMux()
+	protected.Handle(StreamableHTTPPath, server.NewStreamableHTTPServer(p.server))
+	protected.Handle(SSEPath, sse.SSEHandler())
+	protected.Handle(MessagePath, sse.MessageHandler())
+	protected.HandleFunc(OAuthAuthorizePath, p.authorizeServer)
+
+	var handler http.Handler = protected
+	if token != "" {
+		handler = requireToken(token, protected)
+	}
+
+	// the browser comes back from the authorization server without the token, the authorization's state vouches for it
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+	mux.HandleFunc(OAuthCallbackPath, p.completeAuthorization)
+	return mux
+}
+
+// requireToken rejects requests without the bearer token
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
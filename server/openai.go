@@ -0,0 +1,407 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/thirdmartini/mcpgw/pkg/history"
+	"github.com/thirdmartini/mcpgw/pkg/llm"
+	"github.com/thirdmartini/mcpgw/pkg/llm/openai"
+	"github.com/thirdmartini/mcpgw/pkg/mcphost"
+)
+
+// ChatCompletionRequest is the body of an OpenAI chat completion request. The gateway runs its own
+// tools internally, the tools of the request are offered to the llm as well and their calls returned to the client.
+type ChatCompletionRequest struct {
+	Model         string                  `json:"model"`
+	Messages      []ChatCompletionMessage `json:"messages"`
+	Tools         []openai.Tool           `json:"tools,omitempty"`
+	Stream        bool                    `json:"stream,omitempty"`
+	StreamOptions *StreamOptions          `json:"stream_options,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatCompletionMessage is a message of the request, content is either a string or a list of content parts
+type ChatCompletionMessage struct {
+	Role       string            `json:"role"`
+	Content    json.RawMessage   `json:"content,omitempty"`
+	ToolCalls  []openai.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string            `json:"tool_call_id,omitempty"`
+}
+
+// ChatCompletionChunk is one server-sent event of a streamed chat completion
+type ChatCompletionChunk struct {
+	ID      string                      `json:"id"`
+	Object  string                      `json:"object"`
+	Created int64                       `json:"created"`
+	Model   string                      `json:"model"`
+	Choices []ChatCompletionChunkChoice `json:"choices"`
+	Usage   *openai.Usage               `json:"usage,omitempty"`
+}
+
+type ChatCompletionChunkChoice struct {
+	Index        int                 `json:"index"`
+	Delta        ChatCompletionDelta `json:"delta"`
+	FinishReason *string             `json:"finish_reason"`
+}
+
+type ChatCompletionDelta struct {
+	Role      string                   `json:"role,omitempty"`
+	Content   string                   `json:"content,omitempty"`
+	ToolCalls []ChatCompletionToolCall `json:"tool_calls,omitempty"`
+}
+
+// ChatCompletionToolCall is a tool call of a streamed reply, the index orders the calls of the reply
+type ChatCompletionToolCall struct {
+	Index int `json:"index"`
+	openai.ToolCall
+}
+
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// completionError replies with an error in the format of the OpenAI API
+func completionError(w http.ResponseWriter, status int, kind string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(completionErrorBody(kind, err))
+}
+
+func completionErrorBody(kind string, err error) map[string]any {
+	return map[string]any{
+		"error": map[string]string{
+			"message": err.Error(),
+			"type":    kind,
+		},
+	}
+}
+
+// messageText returns the text of a message's content, only text parts are supported
+func messageText(content json.RawMessage) (string, error) {
+	if len(content) == 0 || string(content) == "null" {
+		return "", nil
+	}
+
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", fmt.Errorf("content must be a string or a list of content parts")
+	}
+
+	var texts []string
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("content parts of type %s are not supported", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// completionMessage converts a message of the request into the history the host runs prompts on
+func completionMessage(message ChatCompletionMessage) (history.HistoryMessage, error) {
+	text, err := messageText(message.Content)
+	if err != nil {
+		return history.HistoryMessage{}, err
+	}
+
+	switch message.Role {
+	case "system", "developer", "user":
+		role := message.Role
+		if role == "developer" {
+			role = "system"
+		}
+		return history.HistoryMessage{
+			Role:    role,
+			Content: []history.ContentBlock{{Type: "text", Text: text}},
+		}, nil
+
+	case "assistant":
+		reply := history.HistoryMessage{Role: "assistant"}
+		if text != "" {
+			reply.Content = append(reply.Content, history.ContentBlock{Type: "text", Text: text})
+		}
+		for _, call := range message.ToolCalls {
+			input := json.RawMessage(call.Function.Arguments)
+			if strings.TrimSpace(call.Function.Arguments) == "" {
+				input = json.RawMessage("{}")
+			}
+			if !json.Valid(input) {
+				return history.HistoryMessage{}, fmt.Errorf("the arguments of tool call %s are not valid JSON", call.ID)
+			}
+			reply.Content = append(reply.Content, history.ContentBlock{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Function.Name,
+				Input: input,
+			})
+		}
+		return reply, nil
+
+	case "tool":
+		return history.HistoryMessage{
+			Role:    "tool",
+			Content: []history.ContentBlock{history.NewToolResult(message.ToolCallID, []mcp.Content{mcp.NewTextContent(text)})},
+		}, nil
+	}
+
+	return history.HistoryMessage{}, fmt.Errorf("messages with role %q are not supported", message.Role)
+}
+
+// clientTool converts a tool of the request into the definition offered to the llm
+func clientTool(tool openai.Tool) (llm.Tool, error) {
+	if tool.Type != "" && tool.Type != "function" {
+		return llm.Tool{}, fmt.Errorf("tools of type %s are not supported", tool.Type)
+	}
+	if tool.Function.Name == "" {
+		return llm.Tool{}, fmt.Errorf("tool without a name")
+	}
+
+	schema := llm.Schema{Type: "object", Properties: map[string]interface{}{}}
+	if tool.Function.Parameters != nil {
+		data, _ := json.Marshal(tool.Function.Parameters)
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return llm.Tool{}, fmt.Errorf("the parameters of tool %s are not a JSON schema: %w", tool.Function.Name, err)
+		}
+	}
+
+	return llm.Tool{
+		Name:        tool.Function.Name,
+		Description: tool.Function.Description,
+		InputSchema: schema,
+	}, nil
+}
+
+// completionConversation builds an anonymous conversation from the messages and tools of the request
+func (s *Server) completionConversation(request ChatCompletionRequest) (*mcphost.Conversation, error) {
+	if len(request.Messages) == 0 {
+		return nil, fmt.Errorf("messages must not be empty")
+	}
+
+	conversation := s.conversations.NewConversation()
+	for _, message := range request.Messages {
+		// the client's instructions take the place of the configured system prompt
+		if message.Role == "system" || message.Role == "developer" {
+			conversation.Messages = nil
+			break
+		}
+	}
+
+	for i, message := range request.Messages {
+		converted, err := completionMessage(message)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		conversation.Append(converted)
+	}
+
+	for _, tool := range request.Tools {
+		converted, err := clientTool(tool)
+		if err != nil {
+			return nil, err
+		}
+		conversation.ClientTools = append(conversation.ClientTools, converted)
+	}
+	return conversation, nil
+}
+
+// runCompletion runs the turn and returns the reply to the client, tool calls that need approval are declined
+// as the OpenAI API has no way to ask the user. Usage adds up every llm call the turn took.
+func (s *Server) runCompletion(ctx context.Context, conversation *mcphost.Conversation) (openai.Choice, openai.Usage, error) {
+	start := len(conversation.Messages)
+	if err := s.host.RunPrompt(ctx, "", conversation); err != nil {
+		return openai.Choice{}, openai.Usage{}, err
+	}
+	for len(conversation.Pending) > 0 {
+		if err := s.host.ResolveApproval(ctx, conversation, conversation.Pending[0].ID, false); err != nil {
+			return openai.Choice{}, openai.Usage{}, err
+		}
+	}
+
+	var usage openai.Usage
+	var reply history.HistoryMessage
+	for _, message := range conversation.Messages[start:] {
+		if message.Role != "assistant" {
+			continue
+		}
+		usage.PromptTokens += message.Metrics.InputTokenCount
+		usage.CompletionTokens += message.Metrics.OutputTokenCount
+		reply = message
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	content := reply.GetContent()
+	choice := openai.Choice{
+		Message:      openai.MessageParam{Role: "assistant", Content: &content},
+		FinishReason: "stop",
+	}
+	for _, call := range conversation.ClientToolCalls() {
+		choice.FinishReason = "tool_calls"
+		choice.Message.ToolCalls = append(choice.Message.ToolCalls, openai.ToolCall{
+			ID:   call.ID,
+			Type: "function",
+			Function: openai.FunctionCall{
+				Name:      call.Name,
+				Arguments: string(call.Input),
+			},
+		})
+	}
+	if len(choice.Message.ToolCalls) > 0 && content == "" {
+		choice.Message.Content = nil
+	}
+	return choice, usage, nil
+}
+
+// ChatCompletionsRequest handles HTTP POST requests of the OpenAI chat completions API. The gateway's tools
+// run server-side, calls to the tools of the request are returned to the client. With stream set the reply
+// is sent as server-sent chunks once the turn is done.
+func (s *Server) ChatCompletionsRequest(w http.ResponseWriter, r *http.Request) {
+	request := ChatCompletionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		completionError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+
+	conversation, err := s.completionConversation(request)
+	if err != nil {
+		completionError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+
+	id := "chatcmpl-" + uuid.New().String()
+	log.Info("Chat Completion Started", "id", id, "messages", len(request.Messages), "client tools", len(request.Tools), "stream", request.Stream)
+
+	if request.Stream {
+		s.streamChatCompletion(w, r, request, conversation, id)
+		return
+	}
+
+	startTime := time.Now()
+	choice, usage, err := s.runCompletion(r.Context(), conversation)
+	if err != nil {
+		log.Errorf("Error running chat completion: %v", err)
+		completionError(w, http.StatusInternalServerError, "api_error", err)
+		return
+	}
+	log.Info("Chat Completion Completed", "id", id, "finish", choice.FinishReason, "duration", time.Since(startTime).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.APIResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: startTime.Unix(),
+		Model:   s.host.Model(),
+		Usage:   usage,
+		Choices: []openai.Choice{choice},
+	})
+}
+
+// streamChatCompletion answers streaming requests in a compatibility mode, the llm providers don't stream so the
+// whole reply goes out as a single content chunk once the turn is done. The role goes out right away so clients
+// know the request was accepted while the tools run.
+func (s *Server) streamChatCompletion(w http.ResponseWriter, r *http.Request, request ChatCompletionRequest, conversation *mcphost.Conversation, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		completionError(w, http.StatusInternalServerError, "api_error", errors.New("streaming is not supported"))
+		return
+	}
+
+	// the stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	startTime := time.Now()
+	chunk := ChatCompletionChunk{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: startTime.Unix(),
+		Model:   s.host.Model(),
+	}
+	send := func(data any) {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			log.Warn("Failed to encode chunk", "error", err)
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", encoded)
+		flusher.Flush()
+	}
+	sendDelta := func(delta ChatCompletionDelta, finishReason *string) {
+		chunk.Choices = []ChatCompletionChunkChoice{{Delta: delta, FinishReason: finishReason}}
+		send(chunk)
+	}
+
+	sendDelta(ChatCompletionDelta{Role: "assistant"}, nil)
+
+	choice, usage, err := s.runCompletion(r.Context(), conversation)
+	if err != nil {
+		log.Errorf("Error running chat completion: %v", err)
+		send(completionErrorBody("api_error", err))
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		return
+	}
+
+	delta := ChatCompletionDelta{}
+	if choice.Message.Content != nil {
+		delta.Content = *choice.Message.Content
+	}
+	for i, call := range choice.Message.ToolCalls {
+		delta.ToolCalls = append(delta.ToolCalls, ChatCompletionToolCall{Index: i, ToolCall: call})
+	}
+	sendDelta(delta, nil)
+	sendDelta(ChatCompletionDelta{}, &choice.FinishReason)
+
+	if request.StreamOptions != nil && request.StreamOptions.IncludeUsage {
+		chunk.Choices = []ChatCompletionChunkChoice{}
+		chunk.Usage = &usage
+		send(chunk)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+
+	log.Info("Chat Completion Completed", "id", id, "finish", choice.FinishReason, "duration", time.Since(startTime).Seconds())
+}
+
+// ListModelsRequest handles HTTP GET requests of the OpenAI models API, the gateway offers the model of its provider.
+func (s *Server) ListModelsRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ModelList{
+		Object: "list",
+		Data: []Model{{
+			ID:      s.host.Model(),
+			Object:  "model",
+			OwnedBy: "mcpgw",
+		}},
+	})
+}
@@ -5,30 +5,57 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/gorilla/mux"
+	"github.com/mark3labs/mcp-go/mcp"
 
+	"github.com/thirdmartini/mcpgw/pkg/history"
 	"github.com/thirdmartini/mcpgw/pkg/mcphost"
 	"github.com/thirdmartini/mcpgw/pkg/speaker"
 	"github.com/thirdmartini/mcpgw/pkg/transcriber"
 	"github.com/thirdmartini/mcpgw/server/autocert"
 )
 
+// readinessTimeout bounds how long a readiness probe waits for the llm provider
+const readinessTimeout = 5 * time.Second
+
+// eventsKeepalive is how often an idle event stream sends a comment so proxies keep it open
+const eventsKeepalive = 30 * time.Second
+
+// conversationJanitorInterval is how often conversations over their limits are evicted
+const conversationJanitorInterval = time.Minute
+
+// defaultConversationPage and maxConversationPage bound the pages of the conversation list
+const (
+	defaultConversationPage = 50
+	maxConversationPage     = 200
+)
+
+// OAuthCallbackPath is where authorization servers redirect the browser back to after the user signed in
+const OAuthCallbackPath = "/api/v.1/admin/oauth/callback"
+
 type Server struct {
 	host          *mcphost.Host
 	transcriber   transcriber.Transcriber
 	speaker       speaker.Engine
 	conversations *mcphost.ConversationManager
+	reload        func() error
 }
 
 type Request struct {
 	ConversationID string
 	Prompt         string
+
+	// Resources are the uris of MCP resources whose content is attached to the prompt
+	Resources []string `json:",omitempty"`
 }
 
 type Metrics struct {
@@ -50,6 +77,9 @@ type Response struct {
 	Message        string
 	Audio          string
 	Images         []string
+	ToolAudio      []string                  `json:",omitempty"`
+	Resources      []history.Resource        `json:",omitempty"`
+	Pending        []mcphost.PendingToolCall `json:",omitempty"`
 	Metrics        Metrics
 }
 
@@ -68,6 +98,11 @@ func listenStringToAddress(listen string, tls bool) string {
 	return address + listen
 }
 
+// OAuthCallbackURL returns the OAuth callback of a gateway listening on listen
+func OAuthCallbackURL(listen string, tls bool) string {
+	return listenStringToAddress(listen, tls) + OAuthCallbackPath
+}
+
 func (s *Server) chatErrorResponse(w http.ResponseWriter, prompt string, err error) {
 	response := Response{
 		Prompt:  prompt,
@@ -88,24 +123,73 @@ func calculateTokenRate(tokens int, seconds float64) float64 {
 	return float64(tokens) / seconds
 }
 
+// beginConversation claims the conversation of the request for a turn, a busy conversation is answered with 409
+func (s *Server) beginConversation(w http.ResponseWriter, r *http.Request, id string) (*mcphost.Conversation, context.Context, bool) {
+	conversation, ctx, err := s.conversations.GetConversation(r.Context(), id)
+	if errors.Is(err, mcphost.ErrConversationBusy) {
+		w.WriteHeader(http.StatusConflict)
+		s.chatErrorResponse(w, "", err)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Warn("Gave up waiting for conversation", "session", id, "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+	return conversation, ctx, true
+}
+
+// updateConversation changes the metadata of a stored conversation, the change waits for a running turn instead of
+// cancelling it. If it fails an error response is written and false is returned.
+func (s *Server) updateConversation(w http.ResponseWriter, r *http.Request, id string, update func(*mcphost.Conversation) error) (*mcphost.Conversation, bool) {
+	conversation, err := s.conversations.UpdateConversation(r.Context(), id, update)
+	switch {
+	case errors.Is(err, mcphost.ErrUnknownConversation), errors.Is(err, mcphost.ErrUnknownBranch):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		log.Warn("Gave up waiting for conversation", "session", id, "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return nil, false
+	case err != nil:
+		log.Errorf("Error updating conversation: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return conversation, true
+}
+
 // handleChatRequest processes a chat prompt and generates a response, optionally including audio, using the server's resources.
-func (s *Server) handleChatRequest(w http.ResponseWriter, conversation *mcphost.Conversation, prompt string) {
-	log.Info("Chat Request Started", "session", conversation.Id, "prompt", prompt)
+func (s *Server) handleChatRequest(ctx context.Context, w http.ResponseWriter, conversation *mcphost.Conversation, prompt string, resources []string) {
+	log.Info("Chat Request Started", "session", conversation.Id, "prompt", prompt, "resources", len(resources))
 
 	startTime := time.Now()
-	err := s.host.RunPrompt(context.Background(), prompt, conversation)
+	err := s.host.RunPromptWithResources(ctx, prompt, resources, conversation)
+	if errors.Is(err, mcphost.ErrUnknownResource) || errors.Is(err, mcphost.ErrUnknownPrompt) || errors.Is(err, mcphost.ErrPromptArguments) {
+		w.WriteHeader(http.StatusBadRequest)
+		s.chatErrorResponse(w, prompt, err)
+		return
+	}
 	if err != nil {
 		log.Errorf("Error running prompt: %v", err)
 		s.chatErrorResponse(w, prompt, err)
 		return
 	}
 
+	s.sendChatResponse(w, conversation, prompt, startTime)
+}
+
+// sendChatResponse replies with the outcome of the conversation's last turn, optionally including audio.
+func (s *Server) sendChatResponse(w http.ResponseWriter, conversation *mcphost.Conversation, prompt string, startTime time.Time) {
 	cp := conversation.LastResponse()
 	metrics := cp.Metrics
 	response := Response{
-		Prompt:  prompt,
-		Message: cp.Message,
-		Images:  cp.Images,
+		Prompt:    prompt,
+		Message:   cp.Message,
+		Images:    cp.Images,
+		ToolAudio: cp.Audio,
+		Resources: cp.Resources,
+		Pending:   cp.Pending,
 		Metrics: Metrics{
 			InputTokenCount:  metrics.InputTokenCount,
 			InputEvalTime:    metrics.InputEvalTime.Seconds(),
@@ -119,7 +203,7 @@ func (s *Server) handleChatRequest(w http.ResponseWriter, conversation *mcphost.
 	log.Info("Chat Request Completed", "session", conversation.Id, "prompt duration", response.Metrics.RequestTime)
 
 	// if we have a speaker, convert the message to audio
-	if s.speaker != nil {
+	if s.speaker != nil && response.Message != "" {
 		startTime = time.Now()
 		if audio, err := s.speaker.Say(response.Message); err == nil {
 			data, _ := io.ReadAll(audio)
@@ -133,12 +217,18 @@ func (s *Server) handleChatRequest(w http.ResponseWriter, conversation *mcphost.
 	log.Info("Chat Response Sent", "response", response.Message)
 
 	json.NewEncoder(w).Encode(response)
+
+	// conversations are named for the history list after their first exchange
+	s.host.TitleConversation(s.conversations, conversation)
 }
 
 // AudioChatRequest handles HTTP POST requests for audio-based chat interactions.
 // It transcribes audio input, processes the prompt with the server's LLM host, and responds with the generated output.
 func (s *Server) AudioChatRequest(w http.ResponseWriter, r *http.Request) {
-	session := s.conversations.GetConversation(r.Header.Get("X-Conversation-Id"))
+	session, ctx, ok := s.beginConversation(w, r, r.Header.Get("X-Conversation-Id"))
+	if !ok {
+		return
+	}
 	defer s.conversations.PutConversation(session)
 
 	prompt, err := s.Transcribe(r.Body)
@@ -147,19 +237,18 @@ func (s *Server) AudioChatRequest(w http.ResponseWriter, r *http.Request) {
 		s.chatErrorResponse(w, "[no audio]", err)
 		return
 	}
-	s.handleChatRequest(w, session, prompt)
+	s.handleChatRequest(ctx, w, session, prompt, nil)
 }
 
 // AudioTranscribeRequest handles HTTP POST requests for audio transcription.
 // It transcribes audio input from the request body and responds with the transcribed text in JSON format.
 func (s *Server) AudioTranscribeRequest(w http.ResponseWriter, r *http.Request) {
-	session := s.conversations.GetConversation(r.Header.Get("X-Conversation-Id"))
-	defer s.conversations.PutConversation(session)
+	session := r.Header.Get("X-Conversation-Id")
 
-	log.Info("Audio Transcribe Request Started", "session", session.Id)
+	log.Info("Audio Transcribe Request Started", "session", session)
 	startTime := time.Now()
 	defer func() {
-		log.Info("Audio Transcribe Request Completed", "session", session.Id, "duration", time.Since(startTime))
+		log.Info("Audio Transcribe Request Completed", "session", session, "duration", time.Since(startTime))
 	}()
 
 	prompt, err := s.Transcribe(r.Body)
@@ -177,17 +266,388 @@ func (s *Server) AudioTranscribeRequest(w http.ResponseWriter, r *http.Request)
 // ChatRequest handles HTTP POST requests for text-based chat interactions.
 // It processes the request body, executes the chat prompt, and sends a JSON response with the result.
 func (s *Server) ChatRequest(w http.ResponseWriter, r *http.Request) {
-	session := s.conversations.GetConversation(r.Header.Get("X-Conversation-Id"))
+	request := Request{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	session, ctx, ok := s.beginConversation(w, r, r.Header.Get("X-Conversation-Id"))
+	if !ok {
+		return
+	}
+	defer s.conversations.PutConversation(session)
+
+	s.handleChatRequest(ctx, w, session, request.Prompt, request.Resources)
+}
+
+// ApprovalRequest handles HTTP POST requests that approve or deny a tool call waiting for the user's approval.
+// Once every pending call of the conversation is resolved the turn continues and the chat response is returned.
+func (s *Server) ApprovalRequest(w http.ResponseWriter, r *http.Request) {
+	session, ctx, ok := s.beginConversation(w, r, r.Header.Get("X-Conversation-Id"))
+	if !ok {
+		return
+	}
 	defer s.conversations.PutConversation(session)
 
+	vars := mux.Vars(r)
+	approved := vars["action"] == "approve"
+	log.Info("Approval Request Started", "session", session.Id, "tool_call", vars["id"], "approved", approved)
+
+	startTime := time.Now()
+	err := s.host.ResolveApproval(ctx, session, vars["id"], approved)
+	if errors.Is(err, mcphost.ErrNoPendingApproval) {
+		w.WriteHeader(http.StatusNotFound)
+		s.chatErrorResponse(w, "", err)
+		return
+	}
+	if err != nil {
+		log.Errorf("Error resolving approval: %v", err)
+		s.chatErrorResponse(w, "", err)
+		return
+	}
+
+	s.sendChatResponse(w, session, "", startTime)
+}
+
+// EventsRequest handles HTTP GET requests that follow the progress and log notifications of the tool calls
+// of a conversation. Events are sent as server-sent events until the client disconnects.
+func (s *Server) EventsRequest(w http.ResponseWriter, r *http.Request) {
+	conversation := r.Header.Get("X-Conversation-Id")
+	if conversation == "" {
+		conversation = r.URL.Query().Get("conversation")
+	}
+	if conversation == "" {
+		http.Error(w, "missing conversation id", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// the stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	events, cancel := s.host.Subscribe(conversation)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Warn("Failed to encode event", "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// ConversationList is a page of the stored conversations
+type ConversationList struct {
+	Conversations []mcphost.ConversationSummary `json:"conversations"`
+	Total         int                           `json:"total"`
+	Offset        int                           `json:"offset"`
+	Limit         int                           `json:"limit"`
+}
+
+// ConversationDetails is a conversation with its messages
+type ConversationDetails struct {
+	mcphost.ConversationSummary
+	Branch   string                    `json:"branch,omitempty"`
+	Messages []history.HistoryMessage  `json:"messages"`
+	Pending  []mcphost.PendingToolCall `json:"pending,omitempty"`
+}
+
+// queryInt reads an integer query parameter, def is used when it is missing
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return n, nil
+}
+
+// ListConversationsRequest handles HTTP GET requests and lists the stored conversations, most recently updated first.
+// The offset and limit query parameters page through the list.
+func (s *Server) ListConversationsRequest(w http.ResponseWriter, r *http.Request) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultConversationPage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit = min(max(limit, 1), maxConversationPage)
+
+	conversations, total, err := s.conversations.ListConversations(offset, limit)
+	if err != nil {
+		log.Errorf("Error listing conversations: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(ConversationList{
+		Conversations: conversations,
+		Total:         total,
+		Offset:        offset,
+		Limit:         limit,
+	})
+}
+
+// ConversationStatsRequest handles HTTP GET requests and reports the conversations held in memory and their evictions.
+func (s *Server) ConversationStatsRequest(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.conversations.Stats())
+}
+
+// findConversation looks up the conversation of the request, answering 404 when there is none
+func (s *Server) findConversation(w http.ResponseWriter, r *http.Request) (*mcphost.Conversation, bool) {
+	id := mux.Vars(r)["id"]
+	conversation, ok, err := s.conversations.FindConversation(id)
+	if err != nil {
+		log.Errorf("Error loading conversation: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !ok {
+		http.Error(w, "unknown conversation", http.StatusNotFound)
+		return nil, false
+	}
+	return conversation, true
+}
+
+// GetConversationRequest handles HTTP GET requests and returns a conversation with its messages.
+func (s *Server) GetConversationRequest(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := s.findConversation(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(conversationDetails(conversation))
+}
+
+// conversationDetails describes a conversation with the messages of its active branch
+func conversationDetails(conversation *mcphost.Conversation) ConversationDetails {
+	return ConversationDetails{
+		ConversationSummary: conversation.Summary(),
+		Branch:              conversation.Branch,
+		Messages:            conversation.Messages,
+		Pending:             conversation.Pending,
+	}
+}
+
+// ListBranchesRequest handles HTTP GET requests and lists the branches of a conversation.
+func (s *Server) ListBranchesRequest(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := s.findConversation(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(conversation.ListBranches())
+}
+
+// SwitchBranchRequest handles HTTP POST requests that make another branch of a conversation the active one,
+// the conversation is returned with the messages of that branch.
+func (s *Server) SwitchBranchRequest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	conversation, ok := s.updateConversation(w, r, vars["id"], func(conversation *mcphost.Conversation) error {
+		return conversation.SwitchBranch(vars["branch"])
+	})
+	if !ok {
+		return
+	}
+	log.Info("Conversation branch switched", "session", conversation.Id, "branch", conversation.Branch)
+
+	json.NewEncoder(w).Encode(conversationDetails(conversation))
+}
+
+// EditMessageRequest handles HTTP POST requests that replace a user message of a conversation with a new prompt.
+// The conversation branches at the message and the chat response of the new turn is returned.
+func (s *Server) EditMessageRequest(w http.ResponseWriter, r *http.Request) {
 	request := Request{}
-	err := json.NewDecoder(r.Body).Decode(&request)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Prompt) == "" {
+		http.Error(w, "a prompt is required", http.StatusBadRequest)
+		return
+	}
+
+	s.branchRequest(w, r, request.Prompt, func(ctx context.Context, conversation *mcphost.Conversation, id string) error {
+		return s.host.EditMessage(ctx, conversation, id, request.Prompt)
+	})
+}
+
+// RegenerateMessageRequest handles HTTP POST requests that have the llm answer again in place of one of its replies.
+// The conversation branches at the reply and the chat response of the new turn is returned.
+func (s *Server) RegenerateMessageRequest(w http.ResponseWriter, r *http.Request) {
+	s.branchRequest(w, r, "", s.host.RegenerateMessage)
+}
+
+// branchRequest runs a turn that branches the conversation at the message of the request
+func (s *Server) branchRequest(w http.ResponseWriter, r *http.Request, prompt string,
+	run func(ctx context.Context, conversation *mcphost.Conversation, id string) error) {
+	if _, ok := s.findConversation(w, r); !ok {
+		return
+	}
+
+	conversation, ctx, ok := s.beginConversation(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	defer s.conversations.PutConversation(conversation)
+
+	message := mux.Vars(r)["message"]
+	log.Info("Branch Request Started", "session", conversation.Id, "message", message, "prompt", prompt)
+
+	startTime := time.Now()
+	err := run(ctx, conversation, message)
+	if errors.Is(err, mcphost.ErrUnknownMessage) {
+		w.WriteHeader(http.StatusNotFound)
+		s.chatErrorResponse(w, prompt, err)
+		return
+	}
+	if errors.Is(err, mcphost.ErrWrongRole) {
+		w.WriteHeader(http.StatusBadRequest)
+		s.chatErrorResponse(w, prompt, err)
+		return
+	}
 	if err != nil {
+		log.Errorf("Error running prompt: %v", err)
+		s.chatErrorResponse(w, prompt, err)
+		return
+	}
+
+	s.sendChatResponse(w, conversation, prompt, startTime)
+}
+
+// RenameConversationRequest handles HTTP PATCH requests that set the title of a conversation.
+func (s *Server) RenameConversationRequest(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		Title string `json:"title"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Title) == "" {
+		http.Error(w, "a title is required", http.StatusBadRequest)
+		return
+	}
+
+	conversation, ok := s.updateConversation(w, r, mux.Vars(r)["id"], func(conversation *mcphost.Conversation) error {
+		conversation.Title = strings.TrimSpace(request.Title)
+		return nil
+	})
+	if !ok {
+		return
+	}
+	log.Info("Conversation renamed", "session", conversation.Id, "title", conversation.Title)
+
+	json.NewEncoder(w).Encode(conversation.Summary())
+}
+
+// DeleteConversationRequest handles HTTP DELETE requests and removes a conversation.
+func (s *Server) DeleteConversationRequest(w http.ResponseWriter, r *http.Request) {
+	conversation, ok := s.findConversation(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.conversations.DeleteConversation(r.Context(), conversation.Id)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		log.Warn("Gave up waiting for conversation", "session", conversation.Id, "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Errorf("Error deleting conversation: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info("Conversation deleted", "session", conversation.Id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSamplingRequest handles HTTP GET requests and lists the sampling requests of MCP servers waiting for approval.
+func (s *Server) ListSamplingRequest(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.host.PendingSamplings())
+}
+
+// SamplingApprovalRequest handles HTTP POST requests that approve or deny a sampling request of an MCP server.
+func (s *Server) SamplingApprovalRequest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	approved := vars["action"] == "approve"
+
+	err := s.host.ResolveSampling(vars["id"], approved)
+	if errors.Is(err, mcphost.ErrNoPendingSampling) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListElicitationsRequest handles HTTP GET requests and lists the questions of MCP servers waiting for the user's answer,
+// the conversation query parameter lists only the questions sent to that conversation.
+func (s *Server) ListElicitationsRequest(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.host.PendingElicitations(r.URL.Query().Get("conversation")))
+}
+
+// ElicitationRequest handles HTTP POST requests that answer a question of an MCP server. Accepting sends
+// the content of the request body, declining or cancelling lets the tool call continue without an answer.
+// Questions sent to conversations are answered by one of them, named by the conversation query parameter.
+func (s *Server) ElicitationRequest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	request := struct {
+		Content map[string]any `json:"content"`
+	}{}
+	if vars["action"] == string(mcp.ElicitationResponseActionAccept) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	conversation := r.URL.Query().Get("conversation")
+	err := s.host.ResolveElicitation(conversation, vars["id"], mcp.ElicitationResponseAction(vars["action"]), request.Content)
+	switch {
+	case errors.Is(err, mcphost.ErrNoPendingElicitation):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, mcphost.ErrElicitationConversation):
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, mcphost.ErrElicitationContent):
 		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	s.handleChatRequest(w, session, request.Prompt)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetAvailableTools handles HTTP GET requests and retrieves a list of tools available from the server's host.
@@ -197,6 +657,195 @@ func (s *Server) GetAvailableTools(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tools)
 }
 
+// ListResourcesRequest handles HTTP GET requests and lists the resources and resource templates of the running MCP servers.
+func (s *Server) ListResourcesRequest(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(struct {
+		Resources []mcphost.ResourceDescription         `json:"resources"`
+		Templates []mcphost.ResourceTemplateDescription `json:"templates"`
+	}{
+		Resources: s.host.ListResources(),
+		Templates: s.host.ListResourceTemplates(),
+	})
+}
+
+// ListPromptsRequest handles HTTP GET requests and lists the prompts of the running MCP servers.
+// A prompt is run by sending "/<name> arg=value ..." as the chat prompt.
+func (s *Server) ListPromptsRequest(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.host.ListPrompts())
+}
+
+// ReadResourceRequest handles HTTP GET requests that read the resource given by the uri query parameter.
+func (s *Server) ReadResourceRequest(w http.ResponseWriter, r *http.Request) {
+	uri := r.URL.Query().Get("uri")
+	if uri == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "missing uri"})
+		return
+	}
+
+	contents, err := s.host.ReadResource(r.Context(), uri)
+	switch {
+	case errors.Is(err, mcphost.ErrUnknownResource):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		log.Errorf("Error reading resource: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Contents []mcp.ResourceContents `json:"contents"`
+	}{
+		Contents: contents,
+	})
+}
+
+// ReloadRequest handles HTTP POST requests that reload the MCP server configuration.
+func (s *Server) ReloadRequest(w http.ResponseWriter, r *http.Request) {
+	if s.reload == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	if err := s.reload(); err != nil {
+		log.Errorf("Error reloading config: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	s.GetAvailableTools(w, r)
+}
+
+// serverStatus returns the status of one configured MCP server
+func (s *Server) serverStatus(name string) (mcphost.ServerStatus, bool) {
+	for _, status := range s.host.ServerStatus() {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return mcphost.ServerStatus{}, false
+}
+
+// ListServersRequest handles HTTP GET requests and returns the state, uptime and call statistics of every MCP server.
+func (s *Server) ListServersRequest(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.host.ServerStatus())
+}
+
+// GetServerRequest handles HTTP GET requests for the status of a single MCP server.
+func (s *Server) GetServerRequest(w http.ResponseWriter, r *http.Request) {
+	status, ok := s.serverStatus(mux.Vars(r)["name"])
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": mcphost.ErrUnknownServer.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// ServerControlRequest handles HTTP POST requests that restart, disable or enable an MCP server.
+// The new status of the server is returned.
+func (s *Server) ServerControlRequest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+	log.Info("Server Control Request", "server", name, "action", vars["action"])
+
+	var err error
+	switch vars["action"] {
+	case "restart":
+		err = s.host.RestartServer(name)
+	case "disable":
+		err = s.host.DisableServer(name)
+	case "enable":
+		err = s.host.EnableServer(name)
+	}
+
+	switch {
+	case errors.Is(err, mcphost.ErrUnknownServer):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, mcphost.ErrServerDisabled):
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		log.Errorf("Error controlling server: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.GetServerRequest(w, r)
+}
+
+// AuthorizeServerRequest handles HTTP POST requests that start the OAuth authorization of an MCP server.
+// The returned authorizationUrl has to be opened in a browser to sign in, the authorization server then
+// redirects back to the gateway's OAuth callback.
+func (s *Server) AuthorizeServerRequest(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	log.Info("Server Authorization Request", "server", name)
+
+	authorizationURL, err := s.host.AuthorizeServer(r.Context(), name)
+	switch {
+	case errors.Is(err, mcphost.ErrUnknownServer):
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case errors.Is(err, mcphost.ErrNoOAuth):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		log.Errorf("Error starting authorization: %v", err)
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"authorizationUrl": authorizationURL})
+}
+
+// OAuthCallbackRequest handles the browser redirect from an authorization server at the end of an authorization.
+func (s *Server) OAuthCallbackRequest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if errorCode := query.Get("error"); errorCode != "" {
+		log.Error("Authorization failed", "error", errorCode, "description", query.Get("error_description"))
+		http.Error(w, "Authorization failed: "+errorCode+" "+query.Get("error_description"), http.StatusBadRequest)
+		return
+	}
+
+	name, err := s.host.CompleteAuthorization(r.Context(), query.Get("state"), query.Get("code"))
+	if err != nil {
+		log.Errorf("Error completing authorization: %v", err)
+		http.Error(w, "Authorization failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("mcpGW is now authorized to use " + name + ", you can close this window.\n"))
+}
+
+// LivenessRequest handles HTTP GET requests from liveness probes, it answers as long as the gateway is serving requests.
+func (s *Server) LivenessRequest(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadinessRequest handles HTTP GET requests from readiness probes. It fails with 503 when the llm provider
+// can't be reached or none of the enabled MCP servers are running.
+func (s *Server) ReadinessRequest(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	health := s.host.CheckHealth(ctx)
+	if !health.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
 func (s *Server) createRoutes(root string) *mux.Router {
 	fs := http.Dir(root)
 	router := mux.NewRouter()
@@ -207,9 +856,37 @@ func (s *Server) createRoutes(root string) *mux.Router {
 	})
 
 	router.HandleFunc("/api/v.1/tools", s.GetAvailableTools).Methods("GET")
+	router.HandleFunc("/api/v.1/resources", s.ListResourcesRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/resources/read", s.ReadResourceRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/prompts", s.ListPromptsRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/admin/reload", s.ReloadRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/admin/servers", s.ListServersRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/admin/conversations", s.ConversationStatsRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/admin/servers/{name}", s.GetServerRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/admin/servers/{name}/{action:restart|disable|enable}", s.ServerControlRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/admin/servers/{name}/authorize", s.AuthorizeServerRequest).Methods("POST")
+	router.HandleFunc(OAuthCallbackPath, s.OAuthCallbackRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/health/live", s.LivenessRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/health/ready", s.ReadinessRequest).Methods("GET")
 	router.HandleFunc("/api/v.1/chat", s.ChatRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/approvals/{id}/{action:approve|deny}", s.ApprovalRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/conversations", s.ListConversationsRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/conversations/{id}", s.GetConversationRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/conversations/{id}", s.RenameConversationRequest).Methods("PATCH")
+	router.HandleFunc("/api/v.1/conversations/{id}", s.DeleteConversationRequest).Methods("DELETE")
+	router.HandleFunc("/api/v.1/conversations/{id}/branches", s.ListBranchesRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/conversations/{id}/branches/{branch}/switch", s.SwitchBranchRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/conversations/{id}/messages/{message}/edit", s.EditMessageRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/conversations/{id}/messages/{message}/regenerate", s.RegenerateMessageRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/events", s.EventsRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/sampling", s.ListSamplingRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/sampling/{id}/{action:approve|deny}", s.SamplingApprovalRequest).Methods("POST")
+	router.HandleFunc("/api/v.1/elicitations", s.ListElicitationsRequest).Methods("GET")
+	router.HandleFunc("/api/v.1/elicitations/{id}/{action:accept|decline|cancel}", s.ElicitationRequest).Methods("POST")
 	router.HandleFunc("/api/v.1/recordings/save", s.AudioChatRequest).Methods("POST")
 	router.HandleFunc("/api/v.1/recordings/transcribe", s.AudioTranscribeRequest).Methods("POST")
+	router.HandleFunc("/v1/chat/completions", s.ChatCompletionsRequest).Methods("POST")
+	router.HandleFunc("/v1/models", s.ListModelsRequest).Methods("GET")
 
 	return router
 }
@@ -272,6 +949,40 @@ func (s *Server) WithAudioEncoder(speaker speaker.Engine) *Server {
 	return s
 }
 
+// WithReloader sets the function used to reload the MCP server configuration on request.
+func (s *Server) WithReloader(reload func() error) *Server {
+	s.reload = reload
+	return s
+}
+
+// WithConversationStore sets where the server keeps its conversations, by default they are kept in memory.
+func (s *Server) WithConversationStore(store mcphost.ConversationStore) *Server {
+	s.conversations.WithStore(store)
+	return s
+}
+
+// WithConcurrencyPolicy sets what happens to a request for a conversation that is busy with another request
+func (s *Server) WithConcurrencyPolicy(policy mcphost.ConcurrencyPolicy) *Server {
+	s.conversations.WithConcurrencyPolicy(policy)
+	return s
+}
+
+// WithSummarizer has messages that fall out of a conversation's window summarized instead of dropped
+func (s *Server) WithSummarizer(summarizer *mcphost.Summarizer) *Server {
+	s.conversations.WithSummarizer(summarizer)
+	return s
+}
+
+// WithConversationLimits bounds the memory taken by conversations, idle and surplus conversations are evicted
+// in the background until ctx is done.
+func (s *Server) WithConversationLimits(ctx context.Context, limits mcphost.ConversationLimits) *Server {
+	s.conversations.WithLimits(limits)
+	if limits.IdleTimeout > 0 || limits.MaxConversations > 0 {
+		go s.conversations.RunJanitor(ctx, conversationJanitorInterval)
+	}
+	return s
+}
+
 func NewServer(host *mcphost.Host, systemPrompt string) *Server {
 	log.SetLevel(log.DebugLevel)
 